@@ -5,45 +5,625 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/cobratbq/doclib/internal/repo"
 	"github.com/cobratbq/goutils/assert"
+	"github.com/cobratbq/goutils/std/errors"
+	io_ "github.com/cobratbq/goutils/std/io"
 	"github.com/cobratbq/goutils/std/log"
+	os_ "github.com/cobratbq/goutils/std/os"
 )
 
 type config struct {
 	args     []string
 	location string
+	adopt    bool
+	wait     time.Duration
 }
 
 func parseFlags() config {
 	var cfg config
 	flag.StringVar(&cfg.location, "repo", ".", "Location of the repository root directory.")
+	flag.BoolVar(&cfg.adopt, "adopt", false, "Adopt an existing directory without repository marker as repository.")
+	flag.DurationVar(&cfg.wait, "wait", 0, "Duration to wait for the repository lock, if held by another process. (default: fail immediately)")
 	flag.Parse()
 	cfg.args = flag.Args()
 	return cfg
 }
 
-func cmdCheck(cfg *config) {
-	repo, err := repo.OpenRepository(cfg.location)
+func openRepository(cfg *config) *repo.Repo {
+	var docrepo *repo.Repo
+	var err error
+	if cfg.adopt {
+		docrepo, err = repo.AdoptRepository(cfg.location)
+	} else {
+		docrepo, err = repo.OpenRepository(cfg.location)
+	}
+	if errors.Is(err, repo.ErrNotRepository) {
+		os_.ExitWithError(1, "Not a repository: "+cfg.location+". Use 'init' to create a repository, or flag '-adopt' to adopt an existing directory.")
+	}
+	if errors.Is(err, repo.ErrMigrationRequired) {
+		os_.ExitWithError(1, "Failed to open repository: "+err.Error()+". Use 'migrate' to upgrade the repository.")
+	}
 	assert.Success(err, "Failed to open repository at location: "+cfg.location)
-	log.Infoln("Result:", repo.Check())
+	docrepo.SetLockTimeout(cfg.wait)
+	return docrepo
+}
+
+func cmdInit(cfg *config) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	flagTags := flags.String("tags", "", "Comma-separated starter categories and tags, as '<category>' or '<category>/<tag>', with nested tags as e.g. 'topic/programming/go'.")
+	flagHash := flags.String("hash", repo.HashBLAKE2b, "Hash algorithm for identifying documents: "+strings.Join(repo.HashAlgorithms(), ", "))
+	flagLayout := flags.String("layout", repo.LayoutFlat, "Layout of objects in the repository: "+strings.Join(repo.Layouts(), ", "))
+	flagImply := flags.Bool("imply-ancestors", false, "Tagging with a nested tag implies tagging with its ancestors.")
+	flags.Parse(cfg.args[1:])
+	opts := repo.InitOptions{Hash: *flagHash, Layout: *flagLayout, ImplyAncestors: *flagImply}
+	for _, s := range strings.Split(*flagTags, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			opts.Starters = append(opts.Starters, s)
+		}
+	}
+	if _, err := repo.InitRepository(cfg.location, opts); err != nil {
+		os_.ExitWithError(1, "Failed to initialize repository: "+err.Error())
+	}
+}
+
+func cmdCheck(cfg *config) {
+	var opts repo.CheckOptions
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "Report planned changes without applying any of them.")
+	flags.UintVar(&opts.Workers, "workers", 0, "Number of workers for hashing content in parallel. (default: number of CPUs)")
+	flags.BoolVar(&opts.Full, "full", false, "Hash all objects, regardless of previous verifications.")
+	flags.DurationVar(&opts.MaxAge, "max-age", repo.DefaultVerifyMaxAge, "Age after which previous verifications are outdated. (0: never)")
+	flags.Parse(cfg.args[1:])
+	docrepo := openRepository(cfg)
+	report, err := docrepo.Check(opts)
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Check failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Check failed: "+err.Error())
+	}
+	if opts.DryRun {
+		for _, c := range report.Changes {
+			os.Stdout.WriteString("planned: " + c.String() + "\n")
+		}
+	}
+	for _, f := range report.Unresolved() {
+		os.Stdout.WriteString(f.String() + "\n")
+	}
+	log.Infof("Verified content of %d objects, %d unchanged objects skipped.", report.Hashed, report.Cached)
+	log.Infof("Result: %d findings, %d fixed, %d warnings, %d errors.", len(report.Findings), report.CountFixed(),
+		report.Count(repo.SeverityWarning)-report.Count(repo.SeverityError), report.Count(repo.SeverityError))
+	if report.Count(repo.SeverityError) > 0 {
+		os.Exit(2)
+	}
+}
+
+func cmdScrub(cfg *config) {
+	var opts repo.ScrubOptions
+	flags := flag.NewFlagSet("scrub", flag.ExitOnError)
+	flags.Uint64Var(&opts.MaxBytes, "max-bytes", 0, "Budget of content, in bytes, to verify. (0: unlimited)")
+	flags.UintVar(&opts.MaxObjects, "max-objects", 0, "Maximum number of objects to verify. (0: unlimited)")
+	flags.UintVar(&opts.Workers, "workers", 0, "Number of workers for hashing content in parallel. (default: number of CPUs)")
+	flags.Parse(cfg.args[1:])
+	docrepo := openRepository(cfg)
+	report, err := docrepo.Scrub(opts)
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Scrub failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Scrub failed: "+err.Error())
+	}
+	for _, f := range report.Findings {
+		os.Stdout.WriteString(f.String() + "\n")
+	}
+	log.Infof("Result: %d objects verified, %d objects remaining, %d errors.", report.Hashed, report.Remaining,
+		report.Count(repo.SeverityError))
+	if report.Count(repo.SeverityError) > 0 {
+		os.Exit(2)
+	}
+}
+
+func cmdMigrate(cfg *config) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flagDryRun := flags.Bool("dry-run", false, "Report planned changes without applying any of them.")
+	flags.Parse(cfg.args[1:])
+	report, err := repo.Migrate(cfg.location, repo.MigrateOptions{DryRun: *flagDryRun, Adopt: cfg.adopt})
+	if *flagDryRun {
+		for _, c := range report.Changes {
+			os.Stdout.WriteString("planned: " + c.String() + "\n")
+		}
+	}
+	if errors.Is(err, repo.ErrNotRepository) {
+		os_.ExitWithError(1, "Not a repository: "+cfg.location+". Use flag '-adopt' to adopt an existing directory.")
+	} else if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Migration failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Migration failed: "+err.Error())
+	}
+	if report.From == report.To {
+		log.Infoln("Repository is up-to-date, format version", report.To)
+		return
+	}
+	if *flagDryRun {
+		log.Infof("Planned migration from format version %s to %s in %d steps, %d changes.", report.From, report.To,
+			len(report.Steps), len(report.Changes))
+		return
+	}
+	log.Infof("Migrated repository from format version %s to %s in %d steps, %d changes.", report.From, report.To,
+		len(report.Steps), len(report.Changes))
+}
+
+func cmdRehash(cfg *config) {
+	flags := flag.NewFlagSet("rehash", flag.ExitOnError)
+	flagHash := flags.String("hash", "", "Hash algorithm for identifying documents: "+strings.Join(repo.HashAlgorithms(), ", "))
+	flagDryRun := flags.Bool("dry-run", false, "Report planned changes without applying any of them.")
+	flags.Parse(cfg.args[1:])
+	if *flagHash == "" {
+		os_.ExitWithError(1, "Hash algorithm is required. Use flag '-hash' to specify one of: "+
+			strings.Join(repo.HashAlgorithms(), ", "))
+	}
+	docrepo := openRepository(cfg)
+	report, err := docrepo.Rehash(*flagHash, *flagDryRun)
+	if *flagDryRun {
+		for _, c := range report.Changes {
+			os.Stdout.WriteString("planned: " + c.String() + "\n")
+		}
+	}
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Rehash failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Rehash failed: "+err.Error())
+	}
+	log.Infof("Rehash from %s to %s: %s, %d changes.", report.From, report.To, strings.Join(report.Steps, ", "),
+		len(report.Changes))
+}
+
+func cmdRelayout(cfg *config) {
+	flags := flag.NewFlagSet("relayout", flag.ExitOnError)
+	flagLayout := flags.String("layout", "", "Layout of objects in the repository: "+strings.Join(repo.Layouts(), ", "))
+	flagDryRun := flags.Bool("dry-run", false, "Report planned changes without applying any of them.")
+	flags.Parse(cfg.args[1:])
+	if *flagLayout == "" {
+		os_.ExitWithError(1, "Layout is required. Use flag '-layout' to specify one of: "+strings.Join(repo.Layouts(), ", "))
+	}
+	docrepo := openRepository(cfg)
+	report, err := docrepo.Relayout(*flagLayout, *flagDryRun)
+	if *flagDryRun {
+		for _, c := range report.Changes {
+			os.Stdout.WriteString("planned: " + c.String() + "\n")
+		}
+	}
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Relayout failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Relayout failed: "+err.Error())
+	}
+	log.Infof("Relayout from %s to %s: %s, %d changes.", report.From, report.To, strings.Join(report.Steps, ", "),
+		len(report.Changes))
+}
+
+// splitTagSpec splits `<category>[/<tag>]` into category and (possibly nested, possibly empty) tag.
+func splitTagSpec(spec string) (string, string) {
+	cat, tag, _ := strings.Cut(spec, "/")
+	return cat, tag
+}
+
+func cmdTags(cfg *config) {
+	flags := flag.NewFlagSet("tags", flag.ExitOnError)
+	flags.Usage = func() {
+		os.Stderr.WriteString("Usage: tags list|create <cat>[/<tag>]|rename <cat>[/<tag>] <newcat>[/<newtag>]|merge <cat>/<tag> <cat>/<into>|delete <cat>[/<tag>]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(cfg.args[1:])
+	args := flags.Args()
+	if len(args) < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	expect := func(n int) {
+		if len(args) != n+1 {
+			flags.Usage()
+			os.Exit(1)
+		}
+	}
+	docrepo := openRepository(cfg)
+	var err error
+	switch args[0] {
+	case "list":
+		expect(0)
+		// Keys are listed, followed by the directory if its name differs from the key.
+		for _, cat := range docrepo.Categories() {
+			title := docrepo.CategoryTitle(cat)
+			os.Stdout.WriteString(strings.Join(slices.Compact([]string{cat, title}), "\t") + "\n")
+			for _, tag := range docrepo.Tags(cat) {
+				os.Stdout.WriteString(strings.Join(slices.Compact([]string{cat + "/" + tag.Key, title + "/" + tag.Path}), "\t") + "\n")
+			}
+		}
+		return
+	case "create":
+		expect(1)
+		if cat, tag := splitTagSpec(args[1]); tag == "" {
+			err = docrepo.CreateCategory(cat)
+		} else {
+			err = docrepo.CreateTag(cat, tag)
+		}
+	case "rename":
+		expect(2)
+		cat, tag := splitTagSpec(args[1])
+		newcat, newtag := splitTagSpec(args[2])
+		if tag == "" {
+			err = docrepo.RenameCategory(cat, args[2])
+		} else if newcat != cat {
+			os_.ExitWithError(1, "Tags can only be renamed within their category.")
+		} else {
+			err = docrepo.RenameTag(cat, tag, newtag)
+		}
+	case "merge":
+		expect(2)
+		cat, tag := splitTagSpec(args[1])
+		intocat, into := splitTagSpec(args[2])
+		if intocat != cat {
+			os_.ExitWithError(1, "Tags can only be merged within their category.")
+		}
+		err = docrepo.MergeTag(cat, tag, into)
+	case "delete":
+		expect(1)
+		if cat, tag := splitTagSpec(args[1]); tag == "" {
+			err = docrepo.DeleteCategory(cat)
+		} else {
+			err = docrepo.DeleteTag(cat, tag)
+		}
+	default:
+		flags.Usage()
+		os.Exit(1)
+	}
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Tags "+args[0]+" failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Tags "+args[0]+" failed: "+err.Error())
+	}
+	log.Infoln("Tags", args[0], "completed:", strings.Join(args[1:], " "))
+}
+
+func cmdFind(cfg *config) {
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	flagIds := flags.Bool("ids", false, "Print the identifier of each object, followed by its name.")
+	flags.Usage = func() {
+		os.Stderr.WriteString("Usage: find [-ids] '<expr>', e.g. find 'topic/crypto AND NOT status/read'\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(cfg.args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	docrepo := openRepository(cfg)
+	objects, err := docrepo.Query(flags.Arg(0))
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Find failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Find failed: "+err.Error())
+	}
+	for _, obj := range objects {
+		if *flagIds {
+			os.Stdout.WriteString(obj.Id + "\t")
+		}
+		os.Stdout.WriteString(obj.Name + "\n")
+	}
+}
+
+// findObject finds the object with the specified identifier or name.
+func findObject(docrepo *repo.Repo, ref string) (repo.RepoObj, error) {
+	objects, err := docrepo.List()
+	if err != nil {
+		return repo.RepoObj{}, err
+	}
+	if idx := repo.IndexObjectByID(objects, ref); idx >= 0 {
+		return objects[idx], nil
+	}
+	var found []repo.RepoObj
+	for _, obj := range objects {
+		if obj.Name == ref {
+			found = append(found, obj)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return repo.RepoObj{}, errors.Context(errors.ErrIllegal, "no object with identifier or name: "+ref)
+	case 1:
+		return found[0], nil
+	default:
+		return repo.RepoObj{}, errors.Context(errors.ErrIllegal, "multiple objects with name '"+ref+"', specify the identifier")
+	}
+}
+
+func cmdMeta(cfg *config) {
+	flags := flag.NewFlagSet("meta", flag.ExitOnError)
+	flags.Usage = func() {
+		os.Stderr.WriteString("Usage: meta <id-or-name> [<field>=<value> …], with fields: " +
+			strings.Join(repo.MetadataFields(), ", ") + " and the custom fields of the repository schema. " +
+			"An empty value clears the field.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(cfg.args[1:])
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	docrepo := openRepository(cfg)
+	obj, err := findObject(docrepo, flags.Arg(0))
+	if err != nil {
+		os_.ExitWithError(1, "Meta failed: "+err.Error())
+	}
+	for _, arg := range flags.Args()[1:] {
+		field, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			os_.ExitWithError(1, "Meta failed: expected <field>=<value>: "+arg)
+		}
+		if slices.Contains(repo.MetadataFields(), field) {
+			err = obj.Meta.Set(field, value)
+		} else if f, ok := docrepo.Schema().Field(field); !ok {
+			err = errors.Context(errors.ErrIllegal, "unknown field: "+field)
+		} else if value = strings.TrimSpace(value); value == "" {
+			obj.Props.Delete(f.Name)
+		} else if err = f.Validate(value); err == nil {
+			err = obj.Props.Set(f.Name, value)
+		}
+		if err != nil {
+			os_.ExitWithError(1, "Meta failed: "+err.Error())
+		}
+	}
+	if flags.NArg() > 1 {
+		if err := docrepo.Save(obj); errors.Is(err, repo.ErrLocked) {
+			os_.ExitWithError(3, "Meta failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+		} else if err != nil {
+			os_.ExitWithError(1, "Meta failed: "+err.Error())
+		}
+		log.Infoln("Updated metadata of", obj.Name)
+	}
+	os.Stdout.WriteString("id: " + obj.Id + "\nname: " + obj.Name + "\n")
+	for _, field := range repo.MetadataFields() {
+		if value := obj.Meta.Get(field); value != "" {
+			os.Stdout.WriteString(field + ": " + strings.ReplaceAll(value, "\n", "\n  ") + "\n")
+		}
+	}
+	for _, f := range docrepo.Schema().Fields {
+		if value := f.Value(&obj.Props); value != "" {
+			os.Stdout.WriteString(f.Name + ": " + value + "\n")
+		}
+	}
+	// Invalid values are preserved, and reported such that they can be corrected, or cleared with an empty value.
+	if err := obj.Meta.Validate(); err != nil {
+		log.Warnln("Invalid metadata, set the field to correct it:", err.Error())
+	}
+	if err := docrepo.Schema().Validate(&obj.Props); err != nil {
+		log.Warnln("Invalid fields, set the fields to correct them:", err.Error())
+	}
+}
+
+func cmdExportBib(cfg *config) {
+	flags := flag.NewFlagSet("export-bib", flag.ExitOnError)
+	flagOut := flags.String("o", "", "File to write the BibTeX database to. (default: standard output)")
+	flags.Usage = func() {
+		os.Stderr.WriteString("Usage: export-bib [-o <file>] ['<expr>'], exporting all objects or the objects that satisfy the query, see 'find'\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(cfg.args[1:])
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	var query *repo.Query
+	if flags.NArg() == 1 {
+		q, err := repo.ParseQuery(flags.Arg(0))
+		if err != nil {
+			os_.ExitWithError(1, "Export failed: "+err.Error())
+		}
+		query = &q
+	}
+	docrepo := openRepository(cfg)
+	objects, err := repo.ExtractRepoObjectsSorted(docrepo)
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Export failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Export failed: "+err.Error())
+	}
+	// Citation keys are generated over all objects, such that keys do not depend on the selection.
+	keys := repo.CitationKeys(objects)
+	if query != nil {
+		objects = slices.DeleteFunc(objects, func(o repo.RepoObj) bool { return !query.Match(&o) })
+	}
+	out := os.Stdout
+	if *flagOut != "" {
+		if out, err = os.Create(*flagOut); err != nil {
+			os_.ExitWithError(1, "Export failed: "+err.Error())
+		}
+		defer io_.CloseLogged(out, "Failed to gracefully close BibTeX database")
+	}
+	if err := repo.WriteBibTeX(out, objects, keys); err != nil {
+		os_.ExitWithError(1, "Export failed: "+err.Error())
+	}
+	// Keys are recorded upon first export, such that they remain the same when objects are added.
+	for i := range objects {
+		if objects[i].CiteKey != "" {
+			continue
+		}
+		if err := docrepo.RecordCitationKey(objects[i].Id, keys[objects[i].Id]); err != nil {
+			log.Warnln("Failed to record citation key of", objects[i].Name+":", err.Error())
+		}
+	}
+	log.Infof("Exported %d objects.", len(objects))
+}
+
+func cmdImportBib(cfg *config) {
+	flags := flag.NewFlagSet("import-bib", flag.ExitOnError)
+	flagOverwrite := flags.Bool("overwrite", false, "Replace metadata that is already present.")
+	flags.Usage = func() {
+		os.Stderr.WriteString("Usage: import-bib [-overwrite] <file>, matching entries to objects by hash, DOI or file name\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(cfg.args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		os_.ExitWithError(1, "Import failed: "+err.Error())
+	}
+	entries, err := repo.ParseBibTeX(data)
+	if err != nil {
+		os_.ExitWithError(1, "Import failed: "+err.Error())
+	}
+	docrepo := openRepository(cfg)
+	result, err := docrepo.ImportBibTeX(entries, *flagOverwrite)
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Import failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Import failed: "+err.Error())
+	}
+	for _, name := range result.Updated {
+		os.Stdout.WriteString("updated: " + name + "\n")
+	}
+	for _, name := range result.Failed {
+		os.Stdout.WriteString("failed: " + name + "\n")
+	}
+	for _, key := range result.Unmatched {
+		os.Stdout.WriteString("unmatched: " + key + "\n")
+	}
+	log.Infof("Result: %d entries, %d updated, %d unchanged, %d failed, %d unmatched.", len(entries),
+		len(result.Updated), len(result.Unchanged), len(result.Failed), len(result.Unmatched))
+	if len(result.Failed) > 0 {
+		os.Exit(2)
+	}
+}
+
+func cmdImportCSL(cfg *config) {
+	var opts repo.CSLImportOptions
+	flags := flag.NewFlagSet("import-csl", flag.ExitOnError)
+	flags.StringVar(&opts.CollectionCategory, "collections", "collection", "Category for tags of the collections of items. (empty: skip collections)")
+	flags.StringVar(&opts.TagCategory, "tags", "keyword", "Category for the tags of items. (empty: skip tags)")
+	flags.BoolVar(&opts.Overwrite, "overwrite", false, "Replace metadata that is already present.")
+	flags.Usage = func() {
+		os.Stderr.WriteString("Usage: import-csl [-collections <category>] [-tags <category>] [-overwrite] <file>, acquiring the attachments of each item, with paths relative to the file\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(cfg.args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		os_.ExitWithError(1, "Import failed: "+err.Error())
+	}
+	items, err := repo.ParseCSL(data)
+	if err != nil {
+		os_.ExitWithError(1, "Import failed: "+err.Error())
+	}
+	opts.Base = filepath.Dir(flags.Arg(0))
+	docrepo := openRepository(cfg)
+	result, err := docrepo.ImportCSL(items, opts)
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Import failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Import failed: "+err.Error())
+	}
+	for _, name := range result.Acquired {
+		os.Stdout.WriteString("acquired: " + name + "\n")
+	}
+	for _, path := range result.Failed {
+		os.Stdout.WriteString("failed: " + path + "\n")
+	}
+	for _, id := range result.Skipped {
+		os.Stdout.WriteString("skipped: " + id + "\n")
+	}
+	log.Infof("Result: %d items, %d acquired, %d already present, %d failed, %d skipped.", len(items),
+		len(result.Acquired), len(result.Present), len(result.Failed), len(result.Skipped))
+	if len(result.Failed) > 0 {
+		os.Exit(2)
+	}
+}
+
+func cmdImportCalibre(cfg *config) {
+	var opts repo.CalibreImportOptions
+	flags := flag.NewFlagSet("import-calibre", flag.ExitOnError)
+	flags.StringVar(&opts.SubjectCategory, "subjects", "subject", "Category for tags of the subjects of books. (empty: skip subjects)")
+	flags.StringVar(&opts.SeriesCategory, "series", "series", "Category for tags of the series of books. (empty: skip series)")
+	flags.BoolVar(&opts.Overwrite, "overwrite", false, "Replace metadata that is already present.")
+	flags.Usage = func() {
+		os.Stderr.WriteString("Usage: import-calibre [-subjects <category>] [-series <category>] [-overwrite] <dir>, acquiring the formats of each book in the Calibre library\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(cfg.args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	docrepo := openRepository(cfg)
+	result, err := docrepo.ImportCalibre(flags.Arg(0), opts)
+	if errors.Is(err, repo.ErrLocked) {
+		os_.ExitWithError(3, "Import failed: "+err.Error()+". Use flag '-wait' to wait for the lock.")
+	} else if err != nil {
+		os_.ExitWithError(1, "Import failed: "+err.Error())
+	}
+	for _, name := range result.Acquired {
+		os.Stdout.WriteString("acquired: " + name + "\n")
+	}
+	for _, path := range result.Failed {
+		os.Stdout.WriteString("failed: " + path + "\n")
+	}
+	for _, dir := range result.Skipped {
+		os.Stdout.WriteString("skipped: " + dir + "\n")
+	}
+	log.Infof("Result: %d acquired, %d already present, %d failed, %d skipped.", len(result.Acquired),
+		len(result.Present), len(result.Failed), len(result.Skipped))
+	if len(result.Failed) > 0 {
+		os.Exit(2)
+	}
 }
 
-// TODO eventually, may need to add lock if both UI and cli are used at same time, especially when performing checks/fixes.
 func main() {
 	// TODO consider using spf13/cobra for command-line commands/parameters/shell-completions/...
 	cfg := parseFlags()
 
 	if len(cfg.args) < 1 {
-		os.Stderr.WriteString("Valid commands: init check\n")
+		os.Stderr.WriteString("Valid commands: init check scrub migrate rehash relayout tags find meta export-bib import-bib import-csl import-calibre\n")
 		flag.PrintDefaults()
 		return
 	}
 
 	switch cfg.args[0] {
+	case "init":
+		cmdInit(&cfg)
 	case "check":
 		cmdCheck(&cfg)
+	case "scrub":
+		cmdScrub(&cfg)
+	case "migrate":
+		cmdMigrate(&cfg)
+	case "rehash":
+		cmdRehash(&cfg)
+	case "relayout":
+		cmdRelayout(&cfg)
+	case "tags":
+		cmdTags(&cfg)
+	case "find":
+		cmdFind(&cfg)
+	case "meta":
+		cmdMeta(&cfg)
+	case "export-bib":
+		cmdExportBib(&cfg)
+	case "import-bib":
+		cmdImportBib(&cfg)
+	case "import-csl":
+		cmdImportCSL(&cfg)
+	case "import-calibre":
+		cmdImportCalibre(&cfg)
 	default:
 		flag.PrintDefaults()
 	}
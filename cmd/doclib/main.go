@@ -4,8 +4,12 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -15,28 +19,110 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"github.com/cobratbq/doclib/internal/fyneutils"
 	"github.com/cobratbq/doclib/internal/repo"
 	"github.com/cobratbq/goutils/assert"
 	"github.com/cobratbq/goutils/std/builtin"
 	"github.com/cobratbq/goutils/std/errors"
 	io_ "github.com/cobratbq/goutils/std/io"
 	"github.com/cobratbq/goutils/std/log"
+	os_ "github.com/cobratbq/goutils/std/os"
 )
 
 type interopType struct {
 	id   binding.Int
 	hash binding.String
 	name binding.String
-	tags map[string]map[string]binding.Bool
+	// meta contains the bibliographic metadata fields, see `repo.MetadataFields`.
+	meta map[string]binding.String
+	// schema defines the custom fields, with their values in fields.
+	schema repo.Schema
+	fields map[string]binding.String
+	tags   map[string]map[string]binding.Bool
+	// saved contains the values of the metadata and custom fields of the selected object, as saved. Unchanged
+	// values are not validated, such that invalid values that were preserved do not prevent other changes.
+	saved map[string]string
+}
+
+// savedValues returns the values of the metadata and custom fields of obj, by field name.
+func savedValues(schema repo.Schema, obj *repo.RepoObj) map[string]string {
+	values := map[string]string{}
+	for _, field := range repo.MetadataFields() {
+		values[field] = obj.Meta.Get(field)
+	}
+	for _, f := range schema.Fields {
+		values[f.Name] = f.Value(&obj.Props)
+	}
+	return values
 }
 
 func (i *interopType) valid() bool {
+	for field, v := range i.meta {
+		if value := builtin.Expect(v.Get()); value != i.saved[field] && repo.ValidateMetadata(field, value) != nil {
+			return false
+		}
+	}
+	for _, f := range i.schema.Fields {
+		if value := builtin.Expect(i.fields[f.Name].Get()); value != i.saved[f.Name] && f.Validate(value) != nil {
+			return false
+		}
+	}
 	return builtin.Expect(i.id.Get()) >= 0 &&
 		len(builtin.Expect(i.name.Get())) > 0 &&
 		!strings.ContainsAny(builtin.Expect(i.name.Get()), string([]byte{0, '/'}))
 }
 
+func createViewmodelFields(schema repo.Schema) map[string]binding.String {
+	fields := map[string]binding.String{}
+	for _, f := range schema.Fields {
+		fields[f.Name] = binding.NewString()
+	}
+	return fields
+}
+
+// generateFieldsForm generates the form inputs, as label and input pairs, for the custom fields of the schema.
+func generateFieldsForm(interop *interopType, onChanged binding.DataListener) []fyne.CanvasObject {
+	var form []fyne.CanvasObject
+	for _, f := range interop.schema.Fields {
+		value := interop.fields[f.Name]
+		value.AddListener(onChanged)
+		lblField := widget.NewLabel(f.Name + ":")
+		lblField.TextStyle.Italic = true
+		var input fyne.CanvasObject
+		switch f.Type {
+		case repo.TypeEnum:
+			options := f.Values
+			if !f.Required {
+				options = append([]string{""}, options...)
+			}
+			selectField := widget.NewSelect(options, func(s string) { value.Set(s) })
+			value.AddListener(binding.NewDataListener(func() { selectField.SetSelected(builtin.Expect(value.Get())) }))
+			input = selectField
+		case repo.TypeBool:
+			checkField := widget.NewCheck("", func(b bool) { value.Set(strconv.FormatBool(b)) })
+			value.AddListener(binding.NewDataListener(func() { checkField.SetChecked(builtin.Expect(value.Get()) == "true") }))
+			input = checkField
+		default:
+			entryField := widget.NewEntryWithData(value)
+			entryField.Scroll = fyne.ScrollHorizontalOnly
+			if f.Type == repo.TypeDate {
+				entryField.SetPlaceHolder("YYYY-MM-DD")
+			}
+			entryField.Validator = f.Validate
+			input = entryField
+		}
+		form = append(form, lblField, input)
+	}
+	return form
+}
+
+func createViewmodelMeta() map[string]binding.String {
+	meta := map[string]binding.String{}
+	for _, field := range repo.MetadataFields() {
+		meta[field] = binding.NewString()
+	}
+	return meta
+}
+
 func createViewmodelTags(docrepo *repo.Repo) map[string]map[string]binding.Bool {
 	tags := map[string]map[string]binding.Bool{}
 	for _, cat := range docrepo.Categories() {
@@ -48,51 +134,145 @@ func createViewmodelTags(docrepo *repo.Repo) map[string]map[string]binding.Bool
 	return tags
 }
 
-func generateTagsContainer(group string, interop *interopType, docrepo *repo.Repo) *fyne.Container {
-	lblTag := widget.NewLabel(strings.ToTitle(group) + ":")
-	lblTag.TextStyle.Italic = true
-	container := container.New(fyneutils.NewSignificantOnTop(fyneutils.IsCheckChecked))
+// generateTagsTree generates the tree of (nested) tags of a category, with a check for each tag.
+func generateTagsTree(group string, interop *interopType, docrepo *repo.Repo) *widget.Tree {
+	children := map[string][]string{}
+	titles := map[string]string{}
 	for _, tag := range docrepo.Tags(group) {
-		chk := widget.NewCheckWithData(tag.Title, interop.tags[group][tag.Key])
-		container.Objects = append(container.Objects, chk)
+		children[tag.Parent()] = append(children[tag.Parent()], tag.Key)
+		titles[tag.Key] = tag.Title
 	}
-	return container
+	tree := widget.NewTree(func(id widget.TreeNodeID) []widget.TreeNodeID {
+		return children[id]
+	}, func(id widget.TreeNodeID) bool {
+		return id == "" || len(children[id]) > 0
+	}, func(branch bool) fyne.CanvasObject {
+		return widget.NewCheck("", nil)
+	}, func(id widget.TreeNodeID, branch bool, obj fyne.CanvasObject) {
+		chk := obj.(*widget.Check)
+		chk.Unbind()
+		chk.Text = titles[id]
+		chk.Bind(interop.tags[group][id])
+	})
+	tree.OpenAllBranches()
+	return tree
 }
 
 func generateTagsTabs(docrepo *repo.Repo, interop *interopType) []*container.TabItem {
-	categories := map[string]*fyne.Container{}
 	var items []*container.TabItem
 	for _, cat := range docrepo.Categories() {
-		containerCategory := generateTagsContainer(cat, interop, docrepo)
-		categories[cat] = containerCategory
-		items = append(items, container.NewTabItem(strings.ToTitle(cat), container.NewVScroll(containerCategory)))
+		items = append(items, container.NewTabItem(docrepo.CategoryTitle(cat), generateTagsTree(cat, interop, docrepo)))
 	}
 	return items
 }
 
-func backgroundUpdate(docrepo *repo.Repo, btnCheck *widget.Button, updateStatus func(string, widget.Importance)) {
+func reportCheckResult(report *repo.CheckReport, err error, btnCheck *widget.Button, updateStatus func(string, widget.Importance)) {
+	if err != nil {
+		updateStatus("Check failed: "+err.Error(), widget.WarningImportance)
+		btnCheck.Importance = widget.WarningImportance
+	} else if unresolved := len(report.Unresolved()); unresolved > 0 {
+		updateStatus(fmt.Sprintf("Check finished: %d issues fixed, %d unresolved (%d errors).", report.CountFixed(),
+			unresolved, report.Count(repo.SeverityError)), widget.WarningImportance)
+		btnCheck.Importance = widget.WarningImportance
+	} else {
+		updateStatus(fmt.Sprintf("Check finished: %d issues fixed.", report.CountFixed()), widget.MediumImportance)
+		btnCheck.Importance = widget.LowImportance
+	}
+	btnCheck.Enable()
+}
+
+// backgroundUpdate performs the check, making only the changes of plan as previewed and confirmed.
+func backgroundUpdate(docrepo *repo.Repo, plan []repo.Change, btnCheck *widget.Button, updateStatus func(string, widget.Importance)) {
 	defer log.Traceln("UI update-button background thread finished.")
-	err := docrepo.Check()
+	report, err := docrepo.Check(repo.CheckOptions{MaxAge: repo.DefaultVerifyMaxAge, Plan: plan})
 	fyne.DoAndWait(func() {
-		if err == nil {
-			updateStatus("Check finished.", widget.MediumImportance)
-			btnCheck.Importance = widget.LowImportance
-		} else {
-			updateStatus("Check finished with errors: "+err.Error(), widget.MediumImportance)
-			btnCheck.Importance = widget.WarningImportance
+		if errors.Is(err, repo.ErrPlanChanged) {
+			updateStatus("Check cancelled: the repository changed since the preview. No changes were made, please check again.",
+				widget.WarningImportance)
+			btnCheck.Enable()
+			return
 		}
-		btnCheck.Enable()
+		reportCheckResult(&report, err, btnCheck, updateStatus)
+	})
+}
+
+// backgroundSave untags and tags original, then saves obj, i.e. original with the edits applied, with the
+// resulting tags. As tagging records the tags in the properties, tagging is done on original, such that the
+// edits are saved only by saving obj. The tags of original are updated as recorded. Failures of individual
+// tags are reported together, after saving. If the repository is locked, saving is aborted. The returned
+// boolean indicates that obj was saved.
+func backgroundSave(docrepo *repo.Repo, original, obj *repo.RepoObj, untag, tag [][2]string) (bool, error) {
+	defer log.Traceln("UI save-button background thread finished.")
+	var failures []error
+	// Untag first, such that ancestors implied by tagging are not removed afterwards.
+	for _, t := range untag {
+		if err := docrepo.Untag(t[0], t[1], original); errors.Is(err, repo.ErrLocked) {
+			return false, err
+		} else if err != nil {
+			failures = append(failures, errors.Context(err, "untag "+t[0]+"/"+t[1]))
+		}
+	}
+	for _, t := range tag {
+		if err := docrepo.Tag(t[0], t[1], original); errors.Is(err, repo.ErrLocked) {
+			return false, err
+		} else if err != nil {
+			failures = append(failures, errors.Context(err, "tag "+t[0]+"/"+t[1]))
+		}
+	}
+	obj.Tags = original.Clone().Tags
+	if err := docrepo.Save(*obj); err != nil {
+		return false, errors.Context(err, "failed to save updated properties")
+	}
+	if len(failures) > 0 {
+		return true, errors.Aggregate(failures[0], "failed to update tags", failures[1:]...)
+	}
+	return true, nil
+}
+
+// backgroundPreview performs a dry-run check and presents the planned changes for confirmation before the
+// actual check is performed.
+func backgroundPreview(parent fyne.Window, docrepo *repo.Repo, btnCheck *widget.Button, updateStatus func(string, widget.Importance)) {
+	defer log.Traceln("UI check-preview background thread finished.")
+	report, err := docrepo.Check(repo.CheckOptions{DryRun: true, MaxAge: repo.DefaultVerifyMaxAge})
+	fyne.DoAndWait(func() {
+		if err != nil || len(report.Changes) == 0 {
+			// Without planned changes, the dry-run result is identical to the result of the actual check.
+			reportCheckResult(&report, err, btnCheck, updateStatus)
+			return
+		}
+		var changes strings.Builder
+		for _, c := range report.Changes {
+			changes.WriteString(c.String() + "\n")
+		}
+		lblChanges := widget.NewLabel(changes.String())
+		lblChanges.Wrapping = fyne.TextWrapBreak
+		scrollChanges := container.NewVScroll(lblChanges)
+		scrollChanges.SetMinSize(fyne.NewSize(700, 400))
+		confirmDialog := dialog.NewCustomConfirm(fmt.Sprintf("Check: %d planned changes", len(report.Changes)),
+			"Apply", "Cancel", scrollChanges, func(b bool) {
+				if !b {
+					updateStatus("Check cancelled. No changes were made.", widget.MediumImportance)
+					btnCheck.Enable()
+					return
+				}
+				updateStatus("Checking repository…", widget.MediumImportance)
+				go backgroundUpdate(docrepo, report.Changes, btnCheck, updateStatus)
+			}, parent)
+		confirmDialog.Show()
 	})
 }
 
 func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Container {
-	objects := repo.ExtractRepoObjectsSorted(docrepo)
+	objects := builtin.Expect(repo.ExtractRepoObjectsSorted(docrepo))
 	viewmodel := interopType{
 		id:   binding.NewInt(),
 		hash: binding.NewString(),
 		name: binding.NewString(),
+		meta: createViewmodelMeta(),
 		tags: createViewmodelTags(docrepo),
 	}
+	viewmodel.schema = docrepo.Schema()
+	viewmodel.fields = createViewmodelFields(viewmodel.schema)
 	viewmodel.id.Set(-1)
 	// UI components and interaction.
 	lblStatus := widget.NewLabel("")
@@ -105,9 +285,19 @@ func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Con
 	tabsTags := container.NewAppTabs()
 	tabsTags.Items = generateTagsTabs(docrepo, &viewmodel)
 	tabsTags.OnSelected = func(ti *container.TabItem) {
-		ti.Content.(*container.Scroll).Offset = fyne.Position{X: 0, Y: 0}
+		ti.Content.(*widget.Tree).ScrollToTop()
 	}
 	tabsTags.Refresh()
+	// filter is the query that selects the listed objects. An empty filter lists all objects.
+	var filter string
+	// listFiltered lists the objects selected by query. It waits for the repository lock, therefore is called
+	// off the UI goroutine, with the filter captured beforehand.
+	listFiltered := func(query string) ([]repo.RepoObj, error) {
+		if query == "" {
+			return repo.ExtractRepoObjectsSorted(docrepo)
+		}
+		return docrepo.Query(query)
+	}
 	// TODO needs smaller font, more suitable theme, or plain (unthemed) widgets.
 	listObjects := widget.NewList(func() int { return len(objects) }, func() fyne.CanvasObject {
 		return widget.NewLabel("")
@@ -127,6 +317,25 @@ func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Con
 	lblName.TextStyle.Italic = true
 	inputName := widget.NewEntryWithData(viewmodel.name)
 	inputName.Scroll = fyne.ScrollHorizontalOnly
+	formMeta := []fyne.CanvasObject{}
+	for _, field := range repo.MetadataFields() {
+		lblField := widget.NewLabel(field + ":")
+		lblField.TextStyle.Italic = true
+		var inputField *widget.Entry
+		if field == repo.FieldNotes {
+			inputField = widget.NewMultiLineEntry()
+			inputField.Bind(viewmodel.meta[field])
+			inputField.SetMinRowsVisible(3)
+		} else {
+			inputField = widget.NewEntryWithData(viewmodel.meta[field])
+			inputField.Scroll = fyne.ScrollHorizontalOnly
+		}
+		if field == repo.FieldAuthors {
+			inputField.SetPlaceHolder("family, given; family, given")
+		}
+		inputField.Validator = func(s string) error { return repo.ValidateMetadata(field, s) }
+		formMeta = append(formMeta, lblField, inputField)
+	}
 	btnOpenRepoLocation := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
 		cmd := exec.Command("xdg-open", docrepo.Location())
 		if err := cmd.Start(); err != nil {
@@ -137,9 +346,9 @@ func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Con
 	btnOpenRepoLocation.Importance = widget.LowImportance
 	btnCheck := widget.NewButtonWithIcon("Check", theme.ViewRefreshIcon(), nil)
 	btnCheck.OnTapped = func() {
-		updateStatus("Checking repository…", widget.MediumImportance)
+		updateStatus("Checking repository (preview)…", widget.MediumImportance)
 		btnCheck.Disable()
-		go backgroundUpdate(docrepo, btnCheck, updateStatus)
+		go backgroundPreview(parent, docrepo, btnCheck, updateStatus)
 	}
 	btnCheck.Importance = widget.LowImportance
 	btnOpen := widget.NewButtonWithIcon("", theme.MediaPlayIcon(), func() {
@@ -149,27 +358,77 @@ func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Con
 			updateStatus("Failed to open repository object: "+err.Error(), widget.WarningImportance)
 		}
 	})
-	btnSave := widget.NewButtonWithIcon("Save", theme.ConfirmIcon(), func() {
+	btnSave := widget.NewButtonWithIcon("Save", theme.ConfirmIcon(), nil)
+	btnSave.OnTapped = func() {
 		idx := builtin.Expect(viewmodel.id.Get())
-		objects[idx].Name = builtin.Expect(viewmodel.name.Get())
+		// Edits are applied to a copy, which is saved in the background, as tagging and saving wait for the
+		// repository lock. The listed object is updated only after saving succeeds.
+		original, obj := objects[idx].Clone(), objects[idx].Clone()
+		obj.Name = builtin.Expect(viewmodel.name.Get())
+		for field, v := range viewmodel.meta {
+			if value := builtin.Expect(v.Get()); value == obj.Meta.Get(field) {
+				// Unchanged values, including invalid values that were preserved, are left as is.
+				continue
+			} else if err := obj.Meta.Set(field, value); err != nil {
+				log.Traceln("Invalid metadata:", err.Error())
+				updateStatus("Invalid metadata: "+err.Error(), widget.WarningImportance)
+				return
+			}
+		}
+		for field, v := range viewmodel.fields {
+			f, _ := docrepo.Schema().Field(field)
+			if value := builtin.Expect(v.Get()); value == f.Value(&obj.Props) {
+				// Unchanged values, including defaults of absent fields, are left as is.
+				continue
+			} else if value == "" {
+				obj.Props.Delete(field)
+			} else if err := obj.Props.Set(field, value); err != nil {
+				log.Traceln("Invalid field:", err.Error())
+				updateStatus("Invalid field: "+err.Error(), widget.WarningImportance)
+				return
+			}
+		}
+		var untag, tag [][2]string
 		for cat, tags := range viewmodel.tags {
 			for k, v := range tags {
 				if builtin.Expect(v.Get()) {
-					docrepo.Tag(cat, k, &objects[idx])
+					tag = append(tag, [2]string{cat, k})
 				} else {
-					docrepo.Untag(cat, k, &objects[idx])
+					untag = append(untag, [2]string{cat, k})
 				}
 			}
 		}
-		if err := docrepo.Save(objects[idx]); err != nil {
-			log.Traceln("Failed to save repo-object:", err.Error())
-			updateStatus("Failed to save updated properties: "+err.Error(), widget.WarningImportance)
-			return
-		}
-		listObjects.RefreshItem(idx)
-		btnCheck.Importance = widget.HighImportance
-		btnCheck.Refresh()
-	})
+		btnSave.Disable()
+		go func() {
+			saved, err := backgroundSave(docrepo, &original, &obj, untag, tag)
+			fyne.Do(func() {
+				btnSave.Enable()
+				if !saved {
+					// The edits were not saved, only the tags as recorded are updated.
+					obj = original
+				}
+				if idx < len(objects) && objects[idx].Id == obj.Id {
+					objects[idx] = obj
+					listObjects.RefreshItem(idx)
+				}
+				if builtin.Expect(viewmodel.id.Get()) == idx {
+					viewmodel.saved = savedValues(viewmodel.schema, &obj)
+					for cat, tags := range viewmodel.tags {
+						for k, v := range tags {
+							v.Set(obj.HasTag(cat, k))
+						}
+					}
+				}
+				if err != nil {
+					log.Traceln("Failed to save repo-object:", err.Error())
+					updateStatus("Failed to save "+obj.Name+": "+err.Error(), widget.WarningImportance)
+					return
+				}
+				btnCheck.Importance = widget.HighImportance
+				btnCheck.Refresh()
+			})
+		}()
+	}
 	inputName.Validator = func(s string) error {
 		if len(s) > 0 && !strings.ContainsAny(s, string([]byte{0, '/'})) {
 			return nil
@@ -189,19 +448,48 @@ func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Con
 				updateStatus("", widget.WarningImportance)
 				return
 			}
-			defer io_.CloseLogged(reader, "Failed to gracefully close file.")
-			if newobj, err := docrepo.Acquire(reader, reader.URI().Name()); err == nil {
-				log.Traceln("Import-dialog successfully completed.")
-				objects = repo.ExtractRepoObjectsSorted(docrepo)
-				listObjects.UnselectAll()
-				if id := repo.IndexObjectByID(objects, newobj.Id); id >= 0 {
-					listObjects.Select(id)
+			// The document is acquired in the background, as acquiring waits for the repository lock.
+			updateStatus("Importing document…", widget.MediumImportance)
+			name, query := reader.URI().Name(), filter
+			go func() {
+				defer io_.CloseLogged(reader, "Failed to gracefully close file.")
+				newobj, present, err := docrepo.Acquire(reader, name)
+				var listed []repo.RepoObj
+				var errList error
+				if err == nil {
+					listed, errList = listFiltered(query)
 				}
-				log.Traceln("Document import completed.")
-			} else {
-				log.Traceln("Failed to copy document into repository:", err.Error())
-				updateStatus("Failed to import document into repository: "+err.Error(), widget.WarningImportance)
-			}
+				fyne.Do(func() {
+					if err != nil {
+						log.Traceln("Failed to copy document into repository:", err.Error())
+						updateStatus("Failed to import document into repository: "+err.Error(), widget.WarningImportance)
+						return
+					}
+					log.Traceln("Import-dialog successfully completed.")
+					if errList != nil {
+						log.Warnln("Failed to list repository objects:", errList.Error())
+						updateStatus("Failed to list repository objects: "+errList.Error(), widget.WarningImportance)
+						return
+					}
+					objects = listed
+					listObjects.UnselectAll()
+					if id := repo.IndexObjectByID(objects, newobj.Id); id >= 0 {
+						listObjects.Select(id)
+					}
+					if present {
+						log.Infoln("Imported document is already present in the repository as:", newobj.Name)
+						updateStatus("Document is already present as '"+newobj.Name+"'.", widget.MediumImportance)
+						message := "The imported document is already present in the repository as '" + newobj.Name + "'.\nExisting properties are kept."
+						if name != newobj.Name {
+							message += " The name '" + name + "' is recorded as alias."
+						}
+						dialog.ShowInformation("Document already present", message, parent)
+					} else {
+						updateStatus("Document imported as '"+newobj.Name+"'.", widget.MediumImportance)
+					}
+					log.Traceln("Document import completed.")
+				})
+			}()
 		}, parent)
 		importDialog.SetTitleText("Import document into ")
 		importDialog.SetConfirmText("Import")
@@ -210,56 +498,128 @@ func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Con
 	})
 	btnRemove := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
 		idx := builtin.Expect(viewmodel.id.Get())
-		objname := objects[idx].Name
+		objname, objid := objects[idx].Name, objects[idx].Id
 		confirmDialog := dialog.NewConfirm("Remove repository object", "Do you want to remove '"+objname+"'?",
 			func(b bool) {
 				if !b {
 					return
 				}
-				if err := docrepo.Delete(objects[idx].Id); err != nil {
-					log.Warnln("Repository object deletion failed:", err.Error())
-					updateStatus("Failed to delete object: "+err.Error(), widget.WarningImportance)
-					return
-				}
-				objects = repo.ExtractRepoObjectsSorted(docrepo)
-				listObjects.UnselectAll()
-				log.Infoln("Repository object deleted.")
-				updateStatus("Repository object deleted.", widget.MediumImportance)
+				// The object is deleted in the background, as deleting waits for the repository lock.
+				updateStatus("Deleting '"+objname+"'…", widget.MediumImportance)
+				query := filter
+				go func() {
+					err := docrepo.Delete(objid)
+					var listed []repo.RepoObj
+					var errList error
+					if err == nil {
+						listed, errList = listFiltered(query)
+					}
+					fyne.Do(func() {
+						if err != nil {
+							log.Warnln("Repository object deletion failed:", err.Error())
+							updateStatus("Failed to delete object: "+err.Error(), widget.WarningImportance)
+							return
+						}
+						if errList != nil {
+							log.Warnln("Failed to list repository objects:", errList.Error())
+							updateStatus("Failed to list repository objects: "+errList.Error(), widget.WarningImportance)
+							return
+						}
+						objects = listed
+						listObjects.UnselectAll()
+						log.Infoln("Repository object deleted.")
+						updateStatus("Repository object deleted.", widget.MediumImportance)
+					})
+				}()
 			}, parent)
 		confirmDialog.SetConfirmText("Delete")
 		confirmDialog.SetDismissText("Cancel")
 		confirmDialog.Show()
 	})
 	btnRemove.Importance = widget.LowImportance
+	inputFilter := widget.NewEntry()
+	inputFilter.SetPlaceHolder("Filter, e.g. topic/crypto AND NOT status/read")
+	inputFilter.OnSubmitted = func(text string) {
+		if text = strings.TrimSpace(text); text != "" {
+			if _, err := repo.ParseQuery(text); err != nil {
+				log.Traceln("Invalid filter:", err.Error())
+				updateStatus("Invalid filter: "+err.Error(), widget.WarningImportance)
+				return
+			}
+		}
+		// The objects are listed in the background, as listing waits for the repository lock.
+		go func() {
+			listed, err := listFiltered(text)
+			fyne.Do(func() {
+				if err != nil {
+					log.Warnln("Failed to list repository objects:", err.Error())
+					updateStatus("Failed to list repository objects: "+err.Error(), widget.WarningImportance)
+					return
+				}
+				filter = text
+				objects = listed
+				listObjects.UnselectAll()
+				listObjects.Refresh()
+				if filter == "" {
+					updateStatus("Filter cleared.", widget.MediumImportance)
+				} else {
+					updateStatus(fmt.Sprintf("Filter matches %d objects.", len(objects)), widget.MediumImportance)
+				}
+			})
+		}()
+	}
 	listObjects.OnSelected = func(id widget.ListItemID) {
 		if id < 0 {
+			viewmodel.saved = nil
 			viewmodel.id.Set(-1)
 			viewmodel.hash.Set("")
 			viewmodel.name.Set("")
+			for _, v := range viewmodel.meta {
+				v.Set("")
+			}
+			for _, v := range viewmodel.fields {
+				v.Set("")
+			}
 			for _, tags := range viewmodel.tags {
 				for _, v := range tags {
 					v.Set(false)
 				}
 			}
 		} else {
+			viewmodel.saved = savedValues(viewmodel.schema, &objects[id])
 			viewmodel.id.Set(id)
 			viewmodel.hash.Set(objects[id].Id)
 			viewmodel.name.Set(objects[id].Name)
+			for field, v := range viewmodel.meta {
+				v.Set(objects[id].Meta.Get(field))
+			}
+			for field, v := range viewmodel.fields {
+				f, _ := docrepo.Schema().Field(field)
+				v.Set(f.Value(&objects[id].Props))
+			}
+			tagged := docrepo.ObjectTags(&objects[id])
 			for cat, tags := range viewmodel.tags {
 				for k, v := range tags {
-					v.Set(docrepo.Tagged(cat, k, &objects[id]))
+					v.Set(slices.Contains(tagged[cat], k))
 				}
 			}
 		}
 		if tabsTags.SelectedIndex() >= 0 {
-			tabsTags.Selected().Content.(*container.Scroll).Offset = fyne.Position{X: 0, Y: 0}
+			tabsTags.Selected().Content.(*widget.Tree).ScrollToTop()
 		}
 		fyne.Do(tabsTags.Refresh)
 	}
 	listObjects.OnUnselected = func(id widget.ListItemID) {
+		viewmodel.saved = nil
 		viewmodel.id.Set(-1)
 		viewmodel.hash.Set("")
 		viewmodel.name.Set("")
+		for _, v := range viewmodel.meta {
+			v.Set("")
+		}
+		for _, v := range viewmodel.fields {
+			v.Set("")
+		}
 	}
 	viewmodel.id.AddListener(binding.NewDataListener(func() {
 		if id, err := viewmodel.id.Get(); err == nil && id >= 0 {
@@ -282,30 +642,134 @@ func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Con
 	viewmodel.id.AddListener(validateOnChanged)
 	viewmodel.hash.AddListener(validateOnChanged)
 	viewmodel.name.AddListener(validateOnChanged)
-	parent.SetMainMenu(fyne.NewMainMenu(fyne.NewMenu("File", fyne.NewMenuItem("Reload", func() {
-		// note: keeping this blocking as most UI content is dependent on this process anyways.
-		if err := docrepo.Reload(); err != nil {
-			log.Warnln("Failed to reload repository: " + err.Error())
-			updateStatus("Failed to reload repository: "+err.Error(), widget.WarningImportance)
-			return
+	for _, v := range viewmodel.meta {
+		v.AddListener(validateOnChanged)
+	}
+	formDetails := container.New(layout.NewFormLayout())
+	// layoutDetails (re)populates the form of details, including the inputs for the custom fields of the schema.
+	layoutDetails := func() {
+		formDetails.Objects = slices.Concat(
+			[]fyne.CanvasObject{
+				lblHash, container.NewBorder(nil, nil, nil, btnCopyHash, lblHashValue),
+				lblName, inputName,
+			},
+			formMeta,
+			generateFieldsForm(&viewmodel, validateOnChanged),
+			[]fyne.CanvasObject{
+				layout.NewSpacer(), container.NewBorder(nil, nil, nil, container.NewHBox(btnOpen, btnSave), nil),
+			})
+		formDetails.Refresh()
+	}
+	layoutDetails()
+	// reload rereads the repository and lists the objects in the background, as both wait for the repository
+	// lock, then refreshes the UI content.
+	reload := func(message string) {
+		query := filter
+		go func() {
+			var listed []repo.RepoObj
+			err := docrepo.Reload()
+			if err != nil {
+				err = errors.Context(err, "failed to reload repository")
+			} else if listed, err = listFiltered(query); err != nil {
+				err = errors.Context(err, "failed to list repository objects")
+			}
+			fyne.Do(func() {
+				if err != nil {
+					log.Warnln(err.Error())
+					updateStatus(err.Error(), widget.WarningImportance)
+					return
+				}
+				listObjects.UnselectAll()
+				objects = listed
+				viewmodel.tags = createViewmodelTags(docrepo)
+				viewmodel.schema = docrepo.Schema()
+				viewmodel.fields = createViewmodelFields(viewmodel.schema)
+				layoutDetails()
+				log.Infoln(message)
+				tabsTags.Items = generateTagsTabs(docrepo, &viewmodel)
+				updateStatus(message, widget.MediumImportance)
+				parent.Content().Refresh()
+			})
+		}()
+	}
+	// manageTags shows a form with the specified fields, and applies the operation to the entered values upon
+	// confirmation. Categories and tags are specified as `<category>[/<tag>]`.
+	manageTags := func(title string, fields []string, apply func(values []string) error) func() {
+		return func() {
+			entries := make([]*widget.Entry, len(fields))
+			items := make([]*widget.FormItem, len(fields))
+			for i, f := range fields {
+				entries[i] = widget.NewEntry()
+				entries[i].SetPlaceHolder("category/tag")
+				items[i] = widget.NewFormItem(f, entries[i])
+			}
+			dialog.ShowForm(title, "Apply", "Cancel", items, func(confirmed bool) {
+				if !confirmed {
+					return
+				}
+				values := make([]string, len(entries))
+				for i, e := range entries {
+					values[i] = strings.Trim(e.Text, "/ ")
+				}
+				// The operation is applied in the background, as it waits for the repository lock.
+				updateStatus(title+"…", widget.MediumImportance)
+				go func() {
+					err := apply(values)
+					fyne.Do(func() {
+						if err != nil {
+							log.Warnln(title, "failed:", err.Error())
+							updateStatus(title+" failed: "+err.Error(), widget.WarningImportance)
+							return
+						}
+						reload(title + ": " + strings.Join(values, " → "))
+					})
+				}()
+			}, parent)
 		}
-		listObjects.UnselectAll()
-		objects = repo.ExtractRepoObjectsSorted(docrepo)
-		viewmodel.tags = createViewmodelTags(docrepo)
-		log.Infoln("Repository reloaded.")
-		tabsTags.Items = generateTagsTabs(docrepo, &viewmodel)
-		updateStatus("Repository reloaded.", widget.MediumImportance)
-		parent.Content().Refresh()
-	}))))
+	}
+	parent.SetMainMenu(fyne.NewMainMenu(
+		fyne.NewMenu("File", fyne.NewMenuItem("Reload", func() { reload("Repository reloaded.") })),
+		fyne.NewMenu("Tags",
+			fyne.NewMenuItem("Create…", manageTags("Create category or tag", []string{"Name"}, func(values []string) error {
+				cat, tag, _ := strings.Cut(values[0], "/")
+				if tag == "" {
+					return docrepo.CreateCategory(cat)
+				}
+				return docrepo.CreateTag(cat, tag)
+			})),
+			fyne.NewMenuItem("Rename…", manageTags("Rename category or tag", []string{"Name", "New name"}, func(values []string) error {
+				cat, tag, _ := strings.Cut(values[0], "/")
+				newcat, newtag, _ := strings.Cut(values[1], "/")
+				if tag == "" {
+					return docrepo.RenameCategory(cat, values[1])
+				}
+				if newcat != cat {
+					return errors.Context(errors.ErrIllegal, "tags can only be renamed within their category")
+				}
+				return docrepo.RenameTag(cat, tag, newtag)
+			})),
+			fyne.NewMenuItem("Merge…", manageTags("Merge tag", []string{"Tag", "Into tag"}, func(values []string) error {
+				cat, tag, _ := strings.Cut(values[0], "/")
+				intocat, into, _ := strings.Cut(values[1], "/")
+				if intocat != cat {
+					return errors.Context(errors.ErrIllegal, "tags can only be merged within their category")
+				}
+				return docrepo.MergeTag(cat, tag, into)
+			})),
+			fyne.NewMenuItem("Delete…", manageTags("Delete category or tag", []string{"Name"}, func(values []string) error {
+				cat, tag, _ := strings.Cut(values[0], "/")
+				if tag == "" {
+					return docrepo.DeleteCategory(cat)
+				}
+				return docrepo.DeleteTag(cat, tag)
+			})),
+		),
+	))
 	split := container.NewHSplit(
-		container.NewBorder(nil, container.NewHBox(btnImport, btnRemove, layout.NewSpacer(), btnOpenRepoLocation, btnCheck), nil, nil,
+		container.NewBorder(inputFilter, container.NewHBox(btnImport, btnRemove, layout.NewSpacer(), btnOpenRepoLocation, btnCheck), nil, nil,
 			listObjects),
 		container.NewBorder(
-			container.New(layout.NewFormLayout(),
-				lblHash, container.NewBorder(nil, nil, nil, btnCopyHash, lblHashValue),
-				lblName, inputName,
-				layout.NewSpacer(), container.NewBorder(nil, nil, nil, container.NewHBox(btnOpen, btnSave), nil),
-			), lblStatus, nil, nil,
+			formDetails, lblStatus, nil, nil,
 			tabsTags,
 		),
 	)
@@ -315,15 +779,30 @@ func constructUI(app fyne.App, parent fyne.Window, docrepo *repo.Repo) *fyne.Con
 
 func main() {
 	flagRepo := flag.String("repo", "./data", "Location of the repository.")
+	flagAdopt := flag.Bool("adopt", false, "Adopt an existing directory without repository marker as repository.")
+	flagWait := flag.Duration("wait", 5*time.Second, "Duration to wait for the repository lock, if held by another process.")
 	flag.Parse()
 
-	docrepo, err := repo.OpenRepository(*flagRepo)
+	var docrepo *repo.Repo
+	var err error
+	if *flagAdopt {
+		docrepo, err = repo.AdoptRepository(*flagRepo)
+	} else {
+		docrepo, err = repo.OpenRepository(*flagRepo)
+	}
+	if errors.Is(err, repo.ErrNotRepository) {
+		os_.ExitWithError(1, "Not a repository: "+*flagRepo+". Use 'doccli init' to create a repository, or flag '-adopt' to adopt an existing directory.")
+	}
+	if errors.Is(err, repo.ErrMigrationRequired) {
+		os_.ExitWithError(1, "Failed to open repository: "+err.Error()+". Use 'doccli migrate' to upgrade the repository.")
+	}
 	assert.Success(err, "Failed to open repository at: "+*flagRepo)
+	docrepo.SetLockTimeout(*flagWait)
 
 	app := app.New()
 	mainwnd := app.NewWindow("Doclib")
 	mainwnd.SetPadded(false)
 	mainwnd.Resize(fyne.NewSize(800, 600))
-	mainwnd.SetContent(constructUI(app, mainwnd, &docrepo))
+	mainwnd.SetContent(constructUI(app, mainwnd, docrepo))
 	mainwnd.ShowAndRun()
 }
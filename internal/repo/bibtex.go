@@ -0,0 +1,632 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fields of BibTeX entries that are specific to doclib: the name of the object and its hash, as
+// `<algorithm>:<hex>`, such that entries can be matched to objects upon import.
+const (
+	bibFieldFile = "file"
+	bibFieldHash = "hash"
+)
+
+// BibEntry is an entry of a BibTeX database. Field names are lower-case. Field values are as written in the
+// database, i.e. with LaTeX markup, and with string macros expanded.
+type BibEntry struct {
+	Type   string
+	Key    string
+	Fields map[string]string
+}
+
+// WriteBibTeX writes a BibTeX entry for each object, with the metadata as fields. The entries are written in
+// the order of objects. keys provides the citation key for each object, by identifier, see `CitationKeys`.
+func WriteBibTeX(out io.Writer, objects []RepoObj, keys map[string]string) error {
+	var buffer []byte
+	for i := range objects {
+		buffer = appendBibEntry(buffer, keys[objects[i].Id], &objects[i])
+	}
+	_, err := out.Write(buffer)
+	return err
+}
+
+func appendBibEntry(buffer []byte, key string, obj *RepoObj) []byte {
+	typ := "misc"
+	if obj.Meta.ISBN != "" {
+		typ = "book"
+	} else if obj.Meta.DOI != "" {
+		typ = "article"
+	}
+	buffer = append(buffer, "@"+typ+"{"+key+",\n"...)
+	field := func(name, value string) {
+		if value != "" {
+			buffer = append(buffer, "  "+name+" = {"+value+"},\n"...)
+		}
+	}
+	authors := make([]string, 0, len(obj.Meta.Authors))
+	for _, a := range obj.Meta.Authors {
+		if a = escapeBibText(a); len(splitBibNames(a)) > 1 {
+			// Protect names that contain the word 'and', e.g. of organizations.
+			a = "{" + a + "}"
+		}
+		authors = append(authors, a)
+	}
+	field("author", strings.Join(authors, " and "))
+	field("title", escapeBibText(obj.Meta.Title))
+	field("year", obj.Meta.Get(FieldYear))
+	field("publisher", escapeBibText(obj.Meta.Publisher))
+	field("doi", escapeBibVerbatim(obj.Meta.DOI))
+	field("isbn", obj.Meta.ISBN)
+	field("url", escapeBibVerbatim(obj.Meta.URL))
+	field("language", obj.Meta.Language)
+	field("note", escapeBibText(obj.Meta.Notes))
+	field(bibFieldFile, escapeBibText(obj.Name))
+	field(bibFieldHash, obj.Algorithm+":"+obj.Id)
+	return append(buffer, "}\n\n"...)
+}
+
+// CitationKeys determines the citation key for each object, by identifier. Objects keep the key that was
+// recorded for them, see `RecordCitationKey`. For other objects, a key is generated that is composed of the
+// family name of the first author, the year and the first significant word of the title, e.g. `doe2021paper`.
+// If the key is taken, i.e. recorded for another object or generated for an object with a lower identifier,
+// the key is suffixed with the first characters of the identifier. Keys must be determined over all objects of
+// the repository, regardless of the selection that is exported, and recorded upon export, for keys to remain
+// stable across exports. Objects without authors, year and title are keyed by their identifier.
+func CitationKeys(objects []RepoObj) map[string]string {
+	keys := make(map[string]string, len(objects))
+	taken := map[string]struct{}{}
+	sorted := make([]*RepoObj, len(objects))
+	for i := range objects {
+		sorted[i] = &objects[i]
+	}
+	slices.SortFunc(sorted, func(a, b *RepoObj) int { return strings.Compare(a.Id, b.Id) })
+	for _, o := range sorted {
+		if _, ok := taken[o.CiteKey]; validCitationKey(o.CiteKey) && !ok {
+			keys[o.Id] = o.CiteKey
+			taken[o.CiteKey] = struct{}{}
+		}
+	}
+	for _, o := range sorted {
+		if _, ok := keys[o.Id]; ok {
+			continue
+		}
+		key := citationKey(&o.Meta)
+		if key == "" {
+			key = "doclib-" + o.Id[:min(len(o.Id), 12)]
+		}
+		if _, ok := taken[key]; ok {
+			key += "-" + o.Id[:min(len(o.Id), 6)]
+		}
+		if _, ok := taken[key]; ok {
+			key += o.Id[min(len(o.Id), 6):]
+		}
+		keys[o.Id] = key
+		taken[key] = struct{}{}
+	}
+	return keys
+}
+
+// validCitationKey checks that key is non-empty and consists of characters that are allowed in BibTeX keys.
+func validCitationKey(key string) bool {
+	return key != "" && !strings.ContainsFunc(key, func(c rune) bool {
+		return unicode.IsSpace(c) || strings.ContainsRune(`,{}()"#%'=~\`, c)
+	})
+}
+
+// RecordCitationKey records key as citation key of the object with identifier id, unless a key was recorded
+// before, such that the key remains the same in subsequent exports, regardless of the objects that are added
+// in the mean time. See `CitationKeys`.
+func (r *Repo) RecordCitationKey(id, key string) error {
+	if !validCitationKey(key) {
+		return errors.Context(errors.ErrIllegal, "invalid citation key: "+key)
+	}
+	unlock, err := r.lock(LockShared)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	obj, err := r.openObject(id)
+	if err != nil {
+		return err
+	}
+	if obj.CiteKey != "" {
+		return nil
+	}
+	obj.CiteKey = key
+	return r.writeProperties(&obj)
+}
+
+// citationStopwords are words that are skipped in the title for generating a citation key.
+var citationStopwords = []string{"a", "an", "and", "at", "for", "from", "in", "of", "on", "the", "to", "with"}
+
+func citationKey(m *Metadata) string {
+	var key string
+	if len(m.Authors) > 0 {
+		family, _, ok := strings.Cut(m.Authors[0], ",")
+		if fields := strings.Fields(family); !ok && len(fields) > 0 {
+			family = fields[len(fields)-1]
+		}
+		key = citationWord(family)
+	}
+	if m.Year > 0 {
+		key += strconv.Itoa(m.Year)
+	}
+	for _, w := range strings.Fields(m.Title) {
+		if w = citationWord(w); w != "" && !slices.Contains(citationStopwords, w) {
+			key += w
+			break
+		}
+	}
+	return key
+}
+
+// citationWord reduces a word to lower-case ASCII letters and digits, stripping diacritics.
+func citationWord(word string) string {
+	var b strings.Builder
+	for _, c := range norm.NFKD.String(strings.ToLower(word)) {
+		if c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c)) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeBibText escapes the characters that are special to LaTeX.
+func escapeBibText(value string) string {
+	return strings.NewReplacer(`\`, `\textbackslash{}`, "{", `\textbraceleft{}`, "}", `\textbraceright{}`,
+		"&", `\&`, "%", `\%`, "$", `\$`, "#", `\#`, "_", `\_`, "~", `\textasciitilde{}`, "^", `\textasciicircum{}`,
+	).Replace(value)
+}
+
+// escapeBibVerbatim escapes braces only, for fields that are typeset verbatim, such as URLs.
+func escapeBibVerbatim(value string) string {
+	return strings.NewReplacer("{", "%7B", "}", "%7D").Replace(value)
+}
+
+// ParseBibTeX parses a BibTeX database. `@string`-macros are expanded, `@comment` and `@preamble` are
+// skipped, as is any text outside of entries.
+func ParseBibTeX(data []byte) ([]BibEntry, error) {
+	p := bibParser{data: data, macros: map[string]string{}}
+	for i, month := range []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"} {
+		p.macros[month] = strconv.Itoa(i + 1)
+	}
+	var entries []BibEntry
+	for {
+		idx := slices.Index(data[p.pos:], '@')
+		if idx < 0 {
+			return entries, nil
+		}
+		p.pos += idx + 1
+		entry, err := p.parseEntry()
+		if err != nil {
+			return nil, err
+		}
+		if entry.Type != "" {
+			entries = append(entries, entry)
+		}
+	}
+}
+
+type bibParser struct {
+	data   []byte
+	pos    int
+	macros map[string]string
+}
+
+func (p *bibParser) error(message string) error {
+	line := 1 + bytes.Count(p.data[:min(p.pos, len(p.data))], []byte{'\n'})
+	return errors.Context(errors.ErrIllegal, "bibtex: "+message+" on line "+strconv.Itoa(line))
+}
+
+func (p *bibParser) skipSpace() {
+	for p.pos < len(p.data) && unicode.IsSpace(rune(p.data[p.pos])) {
+		p.pos++
+	}
+}
+
+// expect skips whitespace and consumes c, if present.
+func (p *bibParser) expect(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// identifier reads a name, such as an entry type, field name, macro name or citation key.
+func (p *bibParser) identifier() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.data) && !unicode.IsSpace(rune(p.data[p.pos])) && !strings.ContainsRune(`{}(),="#%'`, rune(p.data[p.pos])) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// parseEntry parses the entry following '@'. Entries other than regular entries, result in an empty type.
+func (p *bibParser) parseEntry() (BibEntry, error) {
+	typ := strings.ToLower(p.identifier())
+	p.skipSpace()
+	if p.pos >= len(p.data) || (p.data[p.pos] != '{' && p.data[p.pos] != '(') {
+		// As with BibTeX, a '@' that does not start an entry, e.g. in an e-mail address in a comment, is ignored.
+		return BibEntry{}, nil
+	}
+	closing := byte('}')
+	if p.data[p.pos] == '(' {
+		closing = ')'
+	}
+	switch typ {
+	case "comment", "preamble":
+		if _, err := p.braced(p.data[p.pos], closing); err != nil {
+			return BibEntry{}, err
+		}
+		return BibEntry{}, nil
+	case "string":
+		p.pos++
+		name := strings.ToLower(p.identifier())
+		if !p.expect('=') {
+			return BibEntry{}, p.error("expected '=' in @string")
+		}
+		value, err := p.value()
+		if err != nil {
+			return BibEntry{}, err
+		}
+		if !p.expect(closing) {
+			return BibEntry{}, p.error("expected '" + string(closing) + "' after @string")
+		}
+		p.macros[name] = value
+		return BibEntry{}, nil
+	}
+	p.pos++
+	entry := BibEntry{Type: typ, Fields: map[string]string{}}
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.data) && p.data[p.pos] != ',' && p.data[p.pos] != closing {
+		p.pos++
+	}
+	entry.Key = strings.TrimSpace(string(p.data[start:p.pos]))
+	for {
+		if p.expect(closing) {
+			return entry, nil
+		}
+		if !p.expect(',') {
+			return BibEntry{}, p.error("expected ',' or '" + string(closing) + "' in entry '" + entry.Key + "'")
+		}
+		if p.expect(closing) {
+			return entry, nil
+		}
+		name := strings.ToLower(p.identifier())
+		if name == "" {
+			return BibEntry{}, p.error("expected field name in entry '" + entry.Key + "'")
+		}
+		if !p.expect('=') {
+			return BibEntry{}, p.error("expected '=' after field '" + name + "' in entry '" + entry.Key + "'")
+		}
+		value, err := p.value()
+		if err != nil {
+			return BibEntry{}, err
+		}
+		entry.Fields[name] = value
+	}
+}
+
+// value parses a field value: braced or quoted text, a number or a macro, concatenated with '#'.
+func (p *bibParser) value() (string, error) {
+	var b strings.Builder
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return "", p.error("unexpected end of input, expected value")
+		}
+		switch c := p.data[p.pos]; {
+		case c == '{':
+			text, err := p.braced('{', '}')
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(text)
+		case c == '"':
+			text, err := p.braced('"', '"')
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(text)
+		default:
+			name := p.identifier()
+			if name == "" {
+				return "", p.error("expected value")
+			}
+			if macro, ok := p.macros[strings.ToLower(name)]; ok {
+				b.WriteString(macro)
+			} else {
+				b.WriteString(name)
+			}
+		}
+		if !p.expect('#') {
+			return b.String(), nil
+		}
+	}
+}
+
+// braced reads the text between the opening and closing characters. As in BibTeX, braces must be balanced
+// and a backslash does not escape a brace.
+func (p *bibParser) braced(opening, closing byte) (string, error) {
+	start := p.pos
+	depth := 0
+	for p.pos++; p.pos < len(p.data); p.pos++ {
+		c := p.data[p.pos]
+		if c == closing && depth == 0 {
+			p.pos++
+			return string(p.data[start+1 : p.pos-1]), nil
+		}
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return "", p.error("unbalanced '}'")
+			}
+			depth--
+		}
+	}
+	p.pos = start
+	return "", p.error("unterminated value, starting with '" + string(opening) + "'")
+}
+
+// BibImport is the result of importing a BibTeX database, see `ImportBibTeX`.
+type BibImport struct {
+	// Updated contains the names of the objects of which the metadata was filled in.
+	Updated []string
+	// Unchanged contains the names of the matched objects for which no changes were needed.
+	Unchanged []string
+	// Failed contains the names of the matched objects for which saving the metadata failed.
+	Failed []string
+	// Unmatched contains the citation keys of the entries that match no object, or multiple objects.
+	Unmatched []string
+}
+
+// ImportBibTeX matches each entry to an object, by hash, DOI or file name, in that order, and fills in the
+// metadata of the object from the fields of the entry. Metadata that is already present, is only replaced if
+// overwrite is set. Values that are invalid as metadata are skipped, with a warning.
+func (r *Repo) ImportBibTeX(entries []BibEntry, overwrite bool) (BibImport, error) {
+	objects, err := r.List()
+	if err != nil {
+		return BibImport{}, err
+	}
+	var result BibImport
+	for i := range entries {
+		idx := matchBibEntry(objects, &entries[i])
+		if idx < 0 {
+			result.Unmatched = append(result.Unmatched, entries[i].Key)
+			continue
+		}
+		obj := &objects[idx]
+		if !applyBibEntry(&obj.Meta, &entries[i], overwrite) {
+			result.Unchanged = append(result.Unchanged, obj.Name)
+			continue
+		}
+		if err := r.Save(*obj); errors.Is(err, ErrLocked) {
+			return result, err
+		} else if err != nil {
+			log.Warnln("Failed to save metadata of", obj.Name, "from entry", entries[i].Key+":", err.Error())
+			result.Failed = append(result.Failed, obj.Name)
+			continue
+		}
+		result.Updated = append(result.Updated, obj.Name)
+	}
+	return result, nil
+}
+
+// matchBibEntry finds the index of the object that corresponds to entry, or -1 if no single object matches.
+func matchBibEntry(objects []RepoObj, entry *BibEntry) int {
+	matchUnique := func(criterion string, match func(o *RepoObj) bool) (int, bool) {
+		idx := -1
+		for i := range objects {
+			if !match(&objects[i]) {
+				continue
+			}
+			if idx >= 0 {
+				log.Warnln("Entry", entry.Key, "matches multiple objects by", criterion+":", objects[idx].Name, "and", objects[i].Name)
+				return -1, true
+			}
+			idx = i
+		}
+		return idx, idx >= 0
+	}
+	if hash := strings.TrimSpace(entry.Fields[bibFieldHash]); hash != "" {
+		algo, id, ok := strings.Cut(hash, ":")
+		if !ok {
+			algo, id = "", hash
+		}
+		if idx, ok := matchUnique("hash", func(o *RepoObj) bool {
+			return strings.EqualFold(o.Id, id) && (algo == "" || algo == o.Algorithm)
+		}); ok {
+			return idx
+		}
+	}
+	if doi, err := normalizeDOI(strings.TrimSpace(entry.Fields["doi"])); err == nil && doi != "" {
+		if idx, ok := matchUnique("DOI", func(o *RepoObj) bool { return strings.EqualFold(o.Meta.DOI, doi) }); ok {
+			return idx
+		}
+	}
+	for _, name := range bibFileNames(entry.Fields[bibFieldFile]) {
+		if idx, ok := matchUnique("file name", func(o *RepoObj) bool {
+			return o.Name == name || slices.Contains(o.Aliases, name)
+		}); ok {
+			return idx
+		}
+	}
+	return -1
+}
+
+// bibFileNames extracts the candidate file names from the value of the file-field: the name as exported by
+// doclib, or the base names of the paths in the JabRef-format `<description>:<path>:<type>;…`.
+func bibFileNames(value string) []string {
+	if value = strings.TrimSpace(value); value == "" {
+		return nil
+	}
+	names := []string{bibText(value)}
+	const colon = "\x00"
+	for _, f := range strings.Split(strings.ReplaceAll(value, `\:`, colon), ";") {
+		parts := strings.Split(f, ":")
+		if len(parts) == 3 {
+			f = parts[1]
+		}
+		f = strings.ReplaceAll(strings.ReplaceAll(f, colon, ":"), `\\`, `\`)
+		if name := strings.TrimSpace(f[strings.LastIndexAny(f, `/\`)+1:]); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// applyBibEntry fills in the metadata from the fields of entry. The result indicates whether metadata was
+// changed.
+func applyBibEntry(m *Metadata, entry *BibEntry, overwrite bool) bool {
+	var authors []string
+	for _, a := range splitBibNames(entry.Fields["author"]) {
+		authors = append(authors, bibText(a))
+	}
+	year := bibText(entry.Fields["year"])
+	if date := bibText(entry.Fields["date"]); year == "" && len(date) >= 4 {
+		year = date[:4]
+	}
+	language := bibText(entry.Fields["language"])
+	if language == "" {
+		language = bibText(entry.Fields["langid"])
+	}
+	values := map[string]string{
+		FieldAuthors:   strings.Join(authors, authorsSeparator+" "),
+		FieldTitle:     bibText(entry.Fields["title"]),
+		FieldYear:      year,
+		FieldPublisher: bibText(entry.Fields["publisher"]),
+		FieldDOI:       strings.TrimSpace(entry.Fields["doi"]),
+		FieldISBN:      bibText(entry.Fields["isbn"]),
+		FieldURL:       strings.TrimSpace(entry.Fields["url"]),
+		FieldLanguage:  language,
+		FieldNotes:     bibNote(entry.Fields["note"]),
+	}
+	return m.fill(values, "entry "+entry.Key, overwrite)
+}
+
+// splitBibNames splits a list of names on the word `and`, outside of braces.
+func splitBibNames(value string) []string {
+	var names []string
+	var depth, start int
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ' ', '\t', '\n', '\r':
+			if depth == 0 && i+5 <= len(value) && strings.EqualFold(value[i+1:i+4], "and") && unicode.IsSpace(rune(value[i+4])) {
+				names = append(names, value[start:i])
+				start = i + 4
+				i += 3
+			}
+		}
+	}
+	names = append(names, value[start:])
+	return slices.DeleteFunc(names, func(n string) bool { return strings.TrimSpace(n) == "" })
+}
+
+// bibSymbols maps LaTeX commands to the text they represent.
+var bibSymbols = map[string]string{
+	"textbackslash": `\`, "textbraceleft": "{", "textbraceright": "}", "textasciitilde": "~", "textasciicircum": "^",
+	"ss": "ß", "o": "ø", "O": "Ø", "aa": "å", "AA": "Å", "ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ", "l": "ł",
+	"L": "Ł", "i": "ı", "j": "ȷ", "textendash": "–", "textemdash": "—", "\\": " ", " ": " ",
+}
+
+// bibAccents maps LaTeX accent commands to the corresponding combining characters.
+var bibAccents = map[string]rune{
+	"'": '\u0301', "`": '\u0300', "^": '\u0302', "\"": '\u0308', "~": '\u0303', "=": '\u0304', ".": '\u0307',
+	"c": '\u0327', "v": '\u030c', "u": '\u0306', "H": '\u030b', "k": '\u0328', "r": '\u030a',
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// bibText converts a BibTeX value to plain text: LaTeX escapes, accents and common symbols are converted,
+// other commands and braces are dropped, and whitespace is collapsed.
+func bibText(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		switch c := value[i]; c {
+		case '{', '}':
+			i++
+		case '~':
+			b.WriteByte(' ')
+			i++
+		case '\\':
+			i++
+			if i >= len(value) {
+				break
+			}
+			end := i + 1
+			for isASCIILetter(value[i]) && end < len(value) && isASCIILetter(value[end]) {
+				end++
+			}
+			cmd := value[i:end]
+			i = end
+			if isASCIILetter(cmd[0]) {
+				// As with TeX, whitespace following a control word is ignored.
+				for i < len(value) && value[i] == ' ' {
+					i++
+				}
+			}
+			if accent, ok := bibAccents[cmd]; ok {
+				braced := i < len(value) && value[i] == '{'
+				if braced {
+					i++
+				}
+				if strings.HasPrefix(value[i:], `\i`) || strings.HasPrefix(value[i:], `\j`) {
+					b.WriteByte(value[i+1])
+					i += 2
+				} else if i < len(value) && value[i] != '}' {
+					r, size := utf8.DecodeRuneInString(value[i:])
+					b.WriteRune(r)
+					i += size
+				}
+				b.WriteRune(accent)
+				if braced && i < len(value) && value[i] == '}' {
+					i++
+				}
+			} else if symbol, ok := bibSymbols[cmd]; ok {
+				b.WriteString(symbol)
+				if strings.HasPrefix(value[i:], "{}") {
+					i += 2
+				}
+			} else if !isASCIILetter(cmd[0]) {
+				b.WriteString(cmd)
+			}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return strings.Join(strings.Fields(norm.NFC.String(b.String())), " ")
+}
+
+// bibNote converts the value of a note to plain text, preserving line-endings.
+func bibNote(value string) string {
+	lines := strings.Split(value, "\n")
+	for i := range lines {
+		lines[i] = bibText(lines[i])
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
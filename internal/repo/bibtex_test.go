@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cobratbq/goutils/std/errors"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func testBibObject(t *testing.T, id, name string, meta map[string]string) RepoObj {
+	obj := RepoObj{Id: id, Algorithm: HashBLAKE2b, Name: name}
+	for field, value := range meta {
+		assert.Nil(t, obj.Meta.Set(field, value))
+	}
+	assert.StopOnFailure(t, name)
+	return obj
+}
+
+func TestBibTeXRoundTrip(t *testing.T) {
+	objects := []RepoObj{
+		testBibObject(t, "c5df7393198eeefab97d", "paper.pdf", map[string]string{
+			FieldAuthors:   "Müller, Jürgen; Research and Development Group; O'Brien, Ann",
+			FieldTitle:     `Braces {x} & 100% $5 #1 a_b ~ ^ \ end`,
+			FieldYear:      "2021",
+			FieldPublisher: "Ærø & Søn",
+			FieldDOI:       "10.1000/a_b.1",
+			FieldISBN:      "9783161484100",
+			FieldURL:       "https://example.org/a_b?q=1%20x",
+			FieldLanguage:  "de",
+			FieldNotes:     "First line, 50% done.\nSecond line: {braces} & more.",
+		}),
+		testBibObject(t, "8f0e2a91b7c3d4e5f6a7", "Élan vital_v2.epub", map[string]string{FieldTitle: "Élan vital"}),
+		testBibObject(t, "0123456789abcdef0123", "unknown.pdf", nil),
+	}
+	keys := CitationKeys(objects)
+	var buffer bytes.Buffer
+	assert.Nil(t, WriteBibTeX(&buffer, objects, keys))
+	entries, err := ParseBibTeX(buffer.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, len(objects), len(entries))
+	assert.StopOnFailure(t, buffer.String())
+	for i := range objects {
+		entry := &entries[i]
+		assert.Equal(t, keys[objects[i].Id], entry.Key)
+		assert.Equal(t, HashBLAKE2b+":"+objects[i].Id, entry.Fields[bibFieldHash])
+		assert.SlicesEqual(t, []string{objects[i].Name}, bibFileNames(entry.Fields[bibFieldFile])[:1])
+		var m Metadata
+		assert.Equal(t, objects[i].Meta.Get(FieldTitle) != "", applyBibEntry(&m, entry, false))
+		for _, field := range MetadataFields() {
+			assert.Equal(t, objects[i].Meta.Get(field), m.Get(field))
+		}
+		assert.LogOnFailure(t, buffer.String())
+	}
+	assert.Equal(t, "book", entries[0].Type)
+	assert.Equal(t, "misc", entries[1].Type)
+	assert.Equal(t, "muller2021braces", entries[0].Key)
+	assert.Equal(t, "elan", entries[1].Key)
+	assert.Equal(t, "doclib-0123456789ab", entries[2].Key)
+}
+
+func TestParseBibTeX(t *testing.T) {
+	const data = `Text outside of entries, with an e-mail address: someone@example.org
+@comment{ Ignored, including @article{fake, title = {Fake}} }
+@Comment This is a comment as well, without braces.
+@preamble{"\newcommand{\noop}[1]{#1}"}
+@string{acm = "ACM Press"}
+@STRING(pub = {Springer})
+@Article{doe2021,
+  Author = {Doe, John and M{\"u}ller, J{\"u}rgen},
+  title = "The " # {Title} # " of " # acm,
+  publisher = pub # {, Berlin},
+  month = jan,
+  year = 2021,
+  note = "Quoted {"braces"} and # characters",
+  series = undefined # { macro},
+}
+@book(key2, title = {Second {\em Book}}, doi = {10.1000/182})
+`
+	entries, err := ParseBibTeX([]byte(data))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.StopOnFailure(t, entries)
+	assert.Equal(t, "article", entries[0].Type)
+	assert.Equal(t, "doe2021", entries[0].Key)
+	assert.Equal(t, `Doe, John and M{\"u}ller, J{\"u}rgen`, entries[0].Fields["author"])
+	assert.Equal(t, "The Title of ACM Press", entries[0].Fields["title"])
+	assert.Equal(t, "Springer, Berlin", entries[0].Fields["publisher"])
+	assert.Equal(t, "1", entries[0].Fields["month"])
+	assert.Equal(t, "2021", entries[0].Fields["year"])
+	assert.Equal(t, `Quoted {"braces"} and # characters`, entries[0].Fields["note"])
+	assert.Equal(t, "undefined macro", entries[0].Fields["series"])
+	assert.Equal(t, "book", entries[1].Type)
+	assert.Equal(t, "key2", entries[1].Key)
+	assert.Equal(t, `Second {\em Book}`, entries[1].Fields["title"])
+	assert.Equal(t, "10.1000/182", entries[1].Fields["doi"])
+}
+
+func TestParseBibTeXInvalid(t *testing.T) {
+	testdata := []string{
+		"@article{key, title = {Unterminated}",
+		`@article{key, title = "Unbalanced}"}`,
+		"@article{key, title}",
+		"@article{key, = {No name}}",
+		"@article{key, title = {Missing comma} year = 2021}",
+		"@string{name {value}}",
+		`@article{key, title = "Unterminated}`,
+	}
+	for _, data := range testdata {
+		_, err := ParseBibTeX([]byte(data))
+		assert.IsError(t, errors.ErrIllegal, err)
+		assert.LogOnFailure(t, data)
+	}
+}
+
+func TestBibText(t *testing.T) {
+	testdata := map[string]string{
+		`M{\"u}ller`:                         "Müller",
+		`M\"{u}ller`:                         "Müller",
+		`M\"uller`:                           "Müller",
+		`Caf\'e`:                             "Café",
+		`Fran\c cois`:                        "François",
+		`Fran\c{c}ois`:                       "François",
+		`Dvo\v{r}\'ak`:                       "Dvořák",
+		`Ma\'{\i}a`:                          "Maía",
+		`Stra\ss{}e`:                         "Straße",
+		`{\O}sterg{\aa}rd`:                   "Østergård",
+		`Erd\H{o}s`:                          "Erdős",
+		`\L{}ukasz`:                          "Łukasz",
+		`{\AE}sir`:                           "Æsir",
+		`Research \& Development`:            "Research & Development",
+		`50\% of \$5 \#1 a\_b`:               "50% of $5 #1 a_b",
+		`Non~breaking  space`:                "Non breaking space",
+		`{The} {\em Emphasized}  X`:          "The Emphasized X",
+		`\textbackslash{}path`:               `\path`,
+		`\textbraceleft{}x\textbraceright{}`: "{x}",
+		`1990\textendash{}1995`:              "1990–1995",
+	}
+	for value, expected := range testdata {
+		assert.Equal(t, expected, bibText(value))
+		assert.LogOnFailure(t, value)
+	}
+}
+
+func TestEscapeBibText(t *testing.T) {
+	testdata := map[string]string{
+		"plain text":      "plain text",
+		"a & b":           `a \& b`,
+		"100% $5 #1 a_b":  `100\% \$5 \#1 a\_b`,
+		"{braces}":        `\textbraceleft{}braces\textbraceright{}`,
+		`back\slash`:      `back\textbackslash{}slash`,
+		"tilde ~ caret ^": `tilde \textasciitilde{} caret \textasciicircum{}`,
+	}
+	for value, expected := range testdata {
+		escaped := escapeBibText(value)
+		assert.Equal(t, expected, escaped)
+		assert.Equal(t, value, bibText(escaped))
+		assert.LogOnFailure(t, value)
+	}
+	assert.Equal(t, "https://example.org/%7Bx%7D", escapeBibVerbatim("https://example.org/{x}"))
+}
+
+func TestSplitBibNames(t *testing.T) {
+	testdata := map[string][]string{
+		"":                              nil,
+		"Doe, John":                     {"Doe, John"},
+		"Doe, John and Smith, Jane":     {"Doe, John", " Smith, Jane"},
+		"Doe, John AND Smith, Jane":     {"Doe, John", " Smith, Jane"},
+		"Anderson, Andy and Sandy":      {"Anderson, Andy", " Sandy"},
+		"{Research and Development}":    {"{Research and Development}"},
+		"{R and D} and\nDoe, John":      {"{R and D}", "\nDoe, John"},
+		"Doe, John and and Smith, Jane": {"Doe, John", " Smith, Jane"},
+	}
+	for value, expected := range testdata {
+		assert.SlicesEqual(t, expected, splitBibNames(value))
+		assert.LogOnFailure(t, value)
+	}
+}
+
+func TestApplyBibEntry(t *testing.T) {
+	entry := BibEntry{Type: "article", Key: "key", Fields: map[string]string{
+		"author":  `Doe, John and {\'E}cole, Anne`,
+		"title":   "{New} Title",
+		"date":    "2020-05-01",
+		"langid":  "en-GB",
+		"doi":     "https://doi.org/10.1000/182",
+		"isbn":    "not an ISBN",
+		"journal": "Ignored",
+	}}
+	m := testBibObject(t, "00", "existing.pdf", map[string]string{FieldTitle: "Old Title"}).Meta
+	assert.True(t, applyBibEntry(&m, &entry, false))
+	assert.SlicesEqual(t, []string{"Doe, John", "École, Anne"}, m.Authors)
+	assert.Equal(t, "Old Title", m.Title)
+	assert.Equal(t, 2020, m.Year)
+	assert.Equal(t, "10.1000/182", m.DOI)
+	assert.Equal(t, "en-GB", m.Language)
+	assert.Equal(t, "", m.ISBN)
+	assert.False(t, applyBibEntry(&m, &entry, false))
+	assert.True(t, applyBibEntry(&m, &entry, true))
+	assert.Equal(t, "New Title", m.Title)
+}
+
+func TestCitationKeys(t *testing.T) {
+	first := testBibObject(t, "aaaaaaaaaaaa", "first.pdf", map[string]string{
+		FieldAuthors: "John von Doe", FieldYear: "2021", FieldTitle: "On the Design of Things"})
+	second := testBibObject(t, "bbbbbbbbbbbb", "second.pdf", map[string]string{
+		FieldAuthors: "von Doe, John", FieldYear: "2021", FieldTitle: "Design of Everything"})
+	other := testBibObject(t, "cccccccccccc", "other.pdf", map[string]string{FieldAuthors: "Ørsted, Hans", FieldTitle: "A Ñandú"})
+	keys := CitationKeys([]RepoObj{first, second, other})
+	assert.Equal(t, "doe2021design", keys[first.Id])
+	assert.Equal(t, "vondoe2021design", keys[second.Id])
+	assert.Equal(t, "rstednandu", keys[other.Id])
+	// Of objects that share a key, the object with the lowest identifier keeps the key.
+	duplicate := testBibObject(t, "dddddddddddd", "duplicate.pdf", map[string]string{
+		FieldAuthors: "John von Doe", FieldYear: "2021", FieldTitle: "The Design"})
+	keys = CitationKeys([]RepoObj{duplicate, first, second, other})
+	assert.Equal(t, "doe2021design", keys[first.Id])
+	assert.Equal(t, "doe2021design-dddddd", keys[duplicate.Id])
+	// Recorded keys are kept, regardless of objects that are added.
+	first.CiteKey, duplicate.CiteKey = keys[first.Id], keys[duplicate.Id]
+	lower := testBibObject(t, "000000000000", "lower.pdf", map[string]string{
+		FieldAuthors: "Doe, Jane", FieldYear: "2021", FieldTitle: "Designs"})
+	custom := testBibObject(t, "eeeeeeeeeeee", "custom.pdf", map[string]string{FieldTitle: "Design"})
+	custom.CiteKey = "my-key"
+	keys = CitationKeys([]RepoObj{first, second, other, duplicate, lower, custom})
+	assert.Equal(t, "doe2021design", keys[first.Id])
+	assert.Equal(t, "doe2021design-dddddd", keys[duplicate.Id])
+	assert.Equal(t, "doe2021designs", keys[lower.Id])
+	assert.Equal(t, "my-key", keys[custom.Id])
+	lower.Meta.Title = "Design"
+	assert.Equal(t, "doe2021design-000000", CitationKeys([]RepoObj{first, lower})[lower.Id])
+	// An empty first author, e.g. due to a stray separator, contributes no family name.
+	empty := RepoObj{Id: "ffffffffffff", Meta: Metadata{Authors: []string{" ", "Doe, John"}, Year: 2021}}
+	assert.Equal(t, "2021", CitationKeys([]RepoObj{empty})[empty.Id])
+	empty.Meta.Authors = []string{""}
+	assert.Equal(t, "2021", CitationKeys([]RepoObj{empty})[empty.Id])
+	// Invalid and duplicate recorded keys are replaced by generated keys.
+	custom.CiteKey = "my key"
+	assert.Equal(t, "design", CitationKeys([]RepoObj{custom})[custom.Id])
+	custom.CiteKey = "doe2021design"
+	assert.Equal(t, "design", CitationKeys([]RepoObj{first, custom})[custom.Id])
+}
+
+func TestRecordCitationKey(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	obj, _, err := r.Acquire(strings.NewReader("content"), "paper.pdf")
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	assert.IsError(t, errors.ErrIllegal, r.RecordCitationKey(obj.Id, "doe 2021"))
+	assert.Nil(t, r.RecordCitationKey(obj.Id, "doe2021"))
+	// A recorded key is not replaced.
+	assert.Nil(t, r.RecordCitationKey(obj.Id, "other"))
+	obj, err = r.OpenObject(obj.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "doe2021", obj.CiteKey)
+	assert.Equal(t, 0, obj.Props.Len())
+}
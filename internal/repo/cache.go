@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cobratbq/goutils/std/builtin/maps"
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+	os_ "github.com/cobratbq/goutils/std/os"
+)
+
+const (
+	// cacheFilename is the name of the verification cache in the repository root.
+	cacheFilename = ".doclib.cache"
+	// DefaultVerifyMaxAge is the default age after which a verification of an object is considered outdated.
+	DefaultVerifyMaxAge = 30 * 24 * time.Hour
+	cacheResultOK       = "ok"
+	cacheResultMismatch = "mismatch"
+	cacheSeparator      = ";"
+)
+
+// verification is the cached result of verifying the content of a repository object, together with the
+// characteristics of the file at the time of verification.
+type verification struct {
+	size     int64
+	mtime    int64
+	inode    uint64
+	verified time.Time
+	ok       bool
+}
+
+func newVerification(info os.FileInfo, verified time.Time, ok bool) verification {
+	return verification{size: info.Size(), mtime: info.ModTime().UnixNano(), inode: inode(info), verified: verified, ok: ok}
+}
+
+// unchanged checks whether the file characteristics are identical to those at the time of verification.
+func (v *verification) unchanged(info os.FileInfo) bool {
+	return v.size == info.Size() && v.mtime == info.ModTime().UnixNano() && v.inode == inode(info)
+}
+
+func (v *verification) String() string {
+	var result = cacheResultMismatch
+	if v.ok {
+		result = cacheResultOK
+	}
+	return strings.Join([]string{strconv.FormatInt(v.size, 10), strconv.FormatInt(v.mtime, 10),
+		strconv.FormatUint(v.inode, 10), v.verified.UTC().Format(time.RFC3339), result}, cacheSeparator)
+}
+
+func parseVerification(value string) (verification, error) {
+	var v verification
+	var err error
+	fields := strings.Split(value, cacheSeparator)
+	if len(fields) != 5 {
+		return v, errors.Context(errors.ErrIllegal, "unexpected number of fields")
+	}
+	if v.size, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return v, errors.Context(err, "invalid size")
+	}
+	if v.mtime, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return v, errors.Context(err, "invalid modification time")
+	}
+	if v.inode, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+		return v, errors.Context(err, "invalid inode")
+	}
+	if v.verified, err = time.Parse(time.RFC3339, fields[3]); err != nil {
+		return v, errors.Context(err, "invalid verification time")
+	}
+	switch fields[4] {
+	case cacheResultOK:
+		v.ok = true
+	case cacheResultMismatch:
+		v.ok = false
+	default:
+		return v, errors.Context(errors.ErrIllegal, "invalid result")
+	}
+	return v, nil
+}
+
+// readVerificationCache reads the verification cache. The cache is not essential: in case of problems, an
+// empty or partial cache is returned, such that affected objects are verified again.
+func readVerificationCache(location string) map[string]verification {
+	cache := map[string]verification{}
+	entries, err := readPropertiesFile(filepath.Join(location, cacheFilename))
+	if os.IsNotExist(err) {
+		return cache
+	} else if err != nil {
+		log.Warnln("Failed to read verification cache. All objects will be verified:", err.Error())
+		return cache
+	}
+	for _, e := range entries {
+		if v, err := parseVerification(e[1]); err == nil {
+			cache[e[0]] = v
+		} else {
+			log.Debugln("Ignoring invalid entry in verification cache for", e[0]+":", err.Error())
+		}
+	}
+	return cache
+}
+
+// updateVerificationCache merges the verifications into the verification cache. The caller is expected to hold
+// the exclusive lock, as verification itself happens without holding the lock, possibly concurrently with
+// other operations and processes. The cache is therefore read again, such that verifications recorded since are
+// preserved: per object, the most recent verification is kept. Entries of objects that no longer exist are
+// dropped.
+func (r *Repo) updateVerificationCache(updates map[string]verification) error {
+	merged := make(map[string]verification, len(updates))
+	for id, v := range readVerificationCache(r.location) {
+		if _, ok := updates[id]; ok || os_.ExistsFile(r.repofilepath(id)) {
+			merged[id] = v
+		}
+	}
+	for id, v := range updates {
+		if !os_.ExistsFile(r.repofilepath(id)) {
+			delete(merged, id)
+		} else if prev, ok := merged[id]; !ok || v.verified.After(prev.verified) {
+			merged[id] = v
+		}
+	}
+	return writeVerificationCache(r.location, merged)
+}
+
+func writeVerificationCache(location string, cache map[string]verification) error {
+	ids := maps.ExtractKeys(cache)
+	slices.Sort(ids)
+	var buffer []byte
+	for _, id := range ids {
+		v := cache[id]
+		buffer = append(buffer, id+"="+v.String()+"\n"...)
+	}
+	return writeFileAtomic(filepath.Join(location, cacheFilename), buffer, 0o600)
+}
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"encoding/xml"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+)
+
+// calibreMetadataFilename is the name of the OPF-file that Calibre stores in the directory of each book, next to
+// the formats of the book.
+const calibreMetadataFilename = "metadata.opf"
+
+// calibreUndefinedDate is the date that Calibre uses for books without a publication date.
+const calibreUndefinedDate = "0101-01-01"
+
+// opfPackage is the OPF-package, restricted to its metadata.
+type opfPackage struct {
+	Metadata opfMetadata `xml:"metadata"`
+}
+
+type opfMetadata struct {
+	Titles      []string        `xml:"http://purl.org/dc/elements/1.1/ title"`
+	Creators    []opfCreator    `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subjects    []string        `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Identifiers []opfIdentifier `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+	Dates       []string        `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Publishers  []string        `xml:"http://purl.org/dc/elements/1.1/ publisher"`
+	Languages   []string        `xml:"http://purl.org/dc/elements/1.1/ language"`
+	Meta        []opfMeta       `xml:"meta"`
+}
+
+type opfCreator struct {
+	Name   string `xml:",chardata"`
+	Role   string `xml:"http://www.idpf.org/2007/opf role,attr"`
+	FileAs string `xml:"http://www.idpf.org/2007/opf file-as,attr"`
+}
+
+type opfIdentifier struct {
+	Value  string `xml:",chardata"`
+	Scheme string `xml:"http://www.idpf.org/2007/opf scheme,attr"`
+}
+
+type opfMeta struct {
+	Name    string `xml:"name,attr"`
+	Content string `xml:"content,attr"`
+}
+
+// CalibreBook is a book in a Calibre library, as described by its OPF-file.
+type CalibreBook struct {
+	// Dir is the directory of the book, which contains the formats.
+	Dir      string
+	Title    string
+	Authors  []string
+	Subjects []string
+	Date     string
+	// Identifiers maps the (lower-case) scheme of an identifier, e.g. `isbn`, to its value.
+	Identifiers map[string]string
+	Publisher   string
+	Language    string
+	Series      string
+}
+
+// ReadCalibreBook reads the OPF-file of the book in directory dir.
+func ReadCalibreBook(dir string) (CalibreBook, error) {
+	data, err := os.ReadFile(filepath.Join(dir, calibreMetadataFilename))
+	if err != nil {
+		return CalibreBook{}, err
+	}
+	var pkg opfPackage
+	if err := xml.Unmarshal(data, &pkg); err != nil {
+		return CalibreBook{}, errors.Context(err, "failed to parse "+calibreMetadataFilename)
+	}
+	m := &pkg.Metadata
+	book := CalibreBook{Dir: dir, Identifiers: map[string]string{}}
+	if len(m.Titles) > 0 {
+		book.Title = strings.TrimSpace(m.Titles[0])
+	}
+	for _, c := range m.Creators {
+		if c.Role != "" && c.Role != "aut" {
+			continue
+		}
+		// Calibre records the name for sorting, i.e. `<family>, <given>`, as file-as.
+		name := strings.TrimSpace(c.FileAs)
+		if name == "" {
+			name = strings.TrimSpace(c.Name)
+		}
+		if name != "" {
+			book.Authors = append(book.Authors, name)
+		}
+	}
+	for _, s := range m.Subjects {
+		if s = strings.TrimSpace(s); s != "" {
+			book.Subjects = append(book.Subjects, s)
+		}
+	}
+	for _, id := range m.Identifiers {
+		scheme, value := strings.ToLower(strings.TrimSpace(id.Scheme)), strings.TrimSpace(id.Value)
+		if scheme == "" {
+			// Identifiers without scheme attribute are written as `urn:<scheme>:<value>` or `<scheme>:<value>`.
+			var ok bool
+			if scheme, value, ok = strings.Cut(strings.TrimPrefix(value, "urn:"), ":"); !ok {
+				continue
+			}
+			scheme = strings.ToLower(scheme)
+		}
+		book.Identifiers[scheme] = value
+	}
+	if len(m.Dates) > 0 && !strings.HasPrefix(m.Dates[0], calibreUndefinedDate) {
+		book.Date = strings.TrimSpace(m.Dates[0])
+	}
+	if len(m.Publishers) > 0 {
+		book.Publisher = strings.TrimSpace(m.Publishers[0])
+	}
+	if len(m.Languages) > 0 {
+		book.Language = strings.TrimSpace(m.Languages[0])
+	}
+	for _, meta := range m.Meta {
+		if meta.Name == "calibre:series" {
+			book.Series = strings.TrimSpace(meta.Content)
+		}
+	}
+	return book, nil
+}
+
+// metadata returns the metadata fields of the book, by field name.
+func (b *CalibreBook) metadata() map[string]string {
+	var year string
+	if len(b.Date) >= 4 {
+		year = b.Date[:4]
+	}
+	return map[string]string{
+		FieldAuthors:   strings.Join(b.Authors, authorsSeparator+" "),
+		FieldTitle:     b.Title,
+		FieldYear:      year,
+		FieldPublisher: b.Publisher,
+		FieldDOI:       b.Identifiers["doi"],
+		FieldISBN:      b.Identifiers["isbn"],
+		FieldLanguage:  b.Language,
+	}
+}
+
+// Formats returns the paths of the formats of the book, i.e. the files in its directory other than the
+// OPF-file and the cover.
+func (b *CalibreBook) Formats() ([]string, error) {
+	entries, err := os.ReadDir(b.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var formats []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || strings.HasPrefix(name, ".") || name == calibreMetadataFilename ||
+			strings.TrimSuffix(name, filepath.Ext(name)) == "cover" {
+			continue
+		}
+		formats = append(formats, filepath.Join(b.Dir, name))
+	}
+	return formats, nil
+}
+
+// CalibreImportOptions are the options for importing a Calibre library, see `ImportCalibre`.
+type CalibreImportOptions struct {
+	// SubjectCategory is the category in which subjects are imported as tags. Subjects are not imported if empty.
+	SubjectCategory string
+	// SeriesCategory is the category in which series are imported as tags. Series are not imported if empty.
+	SeriesCategory string
+	// Overwrite replaces metadata that is already present.
+	Overwrite bool
+}
+
+// ImportCalibre imports the books of the Calibre library at location. Each book directory, i.e. a directory
+// with an OPF-file, is imported: each format of the book is acquired, see `Acquire`, and its metadata is
+// filled in from the OPF-file. The subjects and series of the book are mapped onto tags in the categories of
+// the options, creating tags as needed. Books are imported into objects by content, hence repeated imports do
+// not create duplicates. Hidden directories, such as Calibre's trash, are skipped.
+func (r *Repo) ImportCalibre(location string, opts CalibreImportOptions) (ImportResult, error) {
+	if err := validateImportCategories(opts.SubjectCategory, opts.SeriesCategory); err != nil {
+		return ImportResult{}, err
+	}
+	var result ImportResult
+	err := filepath.WalkDir(location, func(path string, d fs.DirEntry, err error) error {
+		if err != nil && path == location {
+			return errors.Context(err, "failed to read library")
+		} else if err != nil {
+			log.Warnln("Skipping inaccessible path of library:", path, err.Error())
+			return nil
+		}
+		if d.IsDir() && path != location && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() != calibreMetadataFilename {
+			return nil
+		}
+		book, err := ReadCalibreBook(filepath.Dir(path))
+		if err != nil {
+			log.Warnln("Skipping book with invalid metadata:", path, err.Error())
+			result.Failed = append(result.Failed, path)
+			return nil
+		}
+		formats, err := book.Formats()
+		if err != nil {
+			log.Warnln("Skipping book with inaccessible directory:", book.Dir, err.Error())
+			result.Failed = append(result.Failed, book.Dir)
+			return nil
+		}
+		return r.importItem(&result, book.Dir, formats, book.metadata(), book.classification(&opts), opts.Overwrite)
+	})
+	return result, err
+}
+
+// classification returns the (category, tag)-pairs for the subjects and series of the book.
+func (b *CalibreBook) classification(opts *CalibreImportOptions) [][2]string {
+	var tags [][2]string
+	if opts.SubjectCategory != "" {
+		for _, s := range b.Subjects {
+			tags = append(tags, [2]string{opts.SubjectCategory, s})
+		}
+	}
+	if opts.SeriesCategory != "" && b.Series != "" {
+		tags = append(tags, [2]string{opts.SeriesCategory, b.Series})
+	}
+	return tags
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"path/filepath"
+	"testing"
+
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+const testCalibreLibrary = "testdata/calibre"
+
+func TestReadCalibreBook(t *testing.T) {
+	dir := filepath.Join(testCalibreLibrary, "Doe, John", "On Numbers (1)")
+	book, err := ReadCalibreBook(dir)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t, dir)
+	assert.Equal(t, "On Numbers", book.Title)
+	// Authors are named by file-as, other roles are skipped.
+	assert.SlicesEqual(t, []string{"Doe, John", "Beethoven, Ludwig van"}, book.Authors)
+	assert.SlicesEqual(t, []string{"Cryptography", "Reading List"}, book.Subjects)
+	assert.Equal(t, "2021-05-01T00:00:00+00:00", book.Date)
+	assert.Equal(t, "ACME Press", book.Publisher)
+	assert.Equal(t, "en", book.Language)
+	assert.Equal(t, "Numbers Series", book.Series)
+	assert.Equal(t, 4, len(book.Identifiers))
+	assert.Equal(t, "1", book.Identifiers["calibre"])
+	assert.Equal(t, "9783161484100", book.Identifiers["isbn"])
+	assert.Equal(t, "10.1000/182", book.Identifiers["doi"])
+	meta := book.metadata()
+	assert.Equal(t, "Doe, John; Beethoven, Ludwig van", meta[FieldAuthors])
+	assert.Equal(t, "2021", meta[FieldYear])
+	assert.Equal(t, "9783161484100", meta[FieldISBN])
+	formats, err := book.Formats()
+	assert.Nil(t, err)
+	assert.SlicesEqual(t, []string{filepath.Join(dir, "On Numbers - John Doe.epub"),
+		filepath.Join(dir, "On Numbers - John Doe.pdf")}, formats)
+}
+
+func TestReadCalibreBookUndefined(t *testing.T) {
+	dir := filepath.Join(testCalibreLibrary, "Anonymous", "Undated (2)")
+	book, err := ReadCalibreBook(dir)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t, dir)
+	assert.SlicesEqual(t, []string{"Anonymous"}, book.Authors)
+	// Calibre writes an undefined date as `0101-01-01`.
+	assert.Equal(t, "", book.Date)
+	assert.Equal(t, "", book.metadata()[FieldYear])
+	assert.Equal(t, "", book.Series)
+	// Identifiers without scheme attribute carry the scheme as prefix.
+	assert.Equal(t, "0306406152", book.Identifiers["isbn"])
+	assert.Equal(t, "10.1000/xyz", book.Identifiers["doi"])
+	_, err = ReadCalibreBook(testCalibreLibrary)
+	assert.NotNil(t, err)
+}
+
+func TestCalibreClassification(t *testing.T) {
+	book := CalibreBook{Subjects: []string{"Cryptography"}, Series: "Numbers Series"}
+	assert.SlicesEqual(t, nil, book.classification(&CalibreImportOptions{}))
+	assert.SlicesEqual(t, [][2]string{{"subject", "Cryptography"}, {"series", "Numbers Series"}},
+		book.classification(&CalibreImportOptions{SubjectCategory: "subject", SeriesCategory: "series"}))
+}
+
+func TestImportCalibre(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	opts := CalibreImportOptions{SubjectCategory: "subject", SeriesCategory: "series"}
+	formats := []string{"Undated - Anonymous.txt", "On Numbers - John Doe.epub", "On Numbers - John Doe.pdf"}
+	result, err := r.ImportCalibre(testCalibreLibrary, opts)
+	assert.Nil(t, err)
+	// Calibre's trash is skipped, as are the OPF-files and covers.
+	assert.SlicesEqual(t, formats, result.Acquired)
+	assert.SlicesEqual(t, nil, result.Failed)
+	// Repeated imports do not create duplicates.
+	result, err = r.ImportCalibre(testCalibreLibrary, opts)
+	assert.Nil(t, err)
+	assert.SlicesEqual(t, nil, result.Acquired)
+	assert.SlicesEqual(t, formats, result.Present)
+	objects, err := ExtractRepoObjectsSorted(r)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(objects))
+	assert.StopOnFailure(t)
+	for i := range objects {
+		obj := &objects[i]
+		if obj.Meta.Title == "Undated" {
+			assert.Equal(t, 0, obj.Meta.Year)
+			assert.False(t, obj.HasTag("series", "numbers-series"))
+			continue
+		}
+		assert.Equal(t, "On Numbers", obj.Meta.Title)
+		assert.SlicesEqual(t, []string{"Doe, John", "Beethoven, Ludwig van"}, obj.Meta.Authors)
+		assert.Equal(t, 2021, obj.Meta.Year)
+		assert.Equal(t, "10.1000/182", obj.Meta.DOI)
+		assert.True(t, obj.HasTag("subject", "cryptography"))
+		assert.True(t, obj.HasTag("subject", "reading-list"))
+		assert.True(t, obj.HasTag("series", "numbers-series"))
+		assert.LogOnFailure(t, obj.Name)
+	}
+}
+
+func TestImportCalibreInvalid(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	_, err = r.ImportCalibre(filepath.Join(testCalibreLibrary, "missing"), CalibreImportOptions{})
+	assert.NotNil(t, err)
+}
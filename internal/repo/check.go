@@ -0,0 +1,876 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cobratbq/goutils/std/builtin"
+	"github.com/cobratbq/goutils/std/builtin/maps"
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+	os_ "github.com/cobratbq/goutils/std/os"
+	strings_ "github.com/cobratbq/goutils/std/strings"
+)
+
+// FindingKind indicates the kind of issue that was found during checking.
+type FindingKind uint8
+
+const (
+	// KindFailure indicates that checking itself failed, e.g. due to I/O errors.
+	KindFailure FindingKind = iota
+	// KindCorruption indicates that object content does not match its checksum.
+	KindCorruption
+	// KindWritableObject indicates that a (immutable) repository object is writable.
+	KindWritableObject
+	// KindOrphanedProperties indicates a properties-file without corresponding object.
+	KindOrphanedProperties
+	// KindMissingProperties indicates an object without (regular) properties-file.
+	KindMissingProperties
+	// KindInvalidProperties indicates a properties-file that cannot be parsed or contains invalid values.
+	KindInvalidProperties
+	// KindForeignObject indicates a file-system object that does not belong where it was found.
+	KindForeignObject
+	// KindTemporaryFile indicates an abandoned temporary file from an interrupted acquisition.
+	KindTemporaryFile
+	// KindDuplicateTitle indicates that multiple objects have the same name.
+	KindDuplicateTitle
+	// KindBrokenSymlink indicates a symlink that does not refer to a repository object.
+	KindBrokenSymlink
+	// KindMisnamedSymlink indicates a symlink whose name does not match the object's name.
+	KindMisnamedSymlink
+	// KindMissingSymlink indicates an absent symlink, for a title or a recorded tag.
+	KindMissingSymlink
+	// KindUnrecordedTag indicates a tag-symlink for a tag that was not recorded in the object's properties.
+	KindUnrecordedTag
+	// KindMisplacedObject indicates an object or properties-file that is not at the location prescribed by the
+	// layout of the repository.
+	KindMisplacedObject
+	// KindTagCollision indicates a category- or tag-directory that resolves to the same key as another
+	// directory, see `sanitizeName`.
+	KindTagCollision
+	// KindSchemaViolation indicates properties with custom fields that do not satisfy the schema.
+	KindSchemaViolation
+)
+
+func (k FindingKind) String() string {
+	switch k {
+	case KindFailure:
+		return "failure"
+	case KindCorruption:
+		return "corruption"
+	case KindWritableObject:
+		return "writable object"
+	case KindOrphanedProperties:
+		return "orphaned properties"
+	case KindMissingProperties:
+		return "missing properties"
+	case KindInvalidProperties:
+		return "invalid properties"
+	case KindForeignObject:
+		return "foreign object"
+	case KindTemporaryFile:
+		return "temporary file"
+	case KindDuplicateTitle:
+		return "duplicate title"
+	case KindBrokenSymlink:
+		return "broken symlink"
+	case KindMisnamedSymlink:
+		return "misnamed symlink"
+	case KindMissingSymlink:
+		return "missing symlink"
+	case KindUnrecordedTag:
+		return "unrecorded tag"
+	case KindMisplacedObject:
+		return "misplaced object"
+	case KindTagCollision:
+		return "tag collision"
+	case KindSchemaViolation:
+		return "schema violation"
+	default:
+		return "unknown"
+	}
+}
+
+// Severity indicates the severity of a finding.
+type Severity uint8
+
+const (
+	// SeverityInfo is for findings that are expected to occur during normal use and can be fixed.
+	SeverityInfo Severity = iota
+	// SeverityWarning is for findings that need attention, but do not indicate loss of data.
+	SeverityWarning
+	// SeverityError is for findings that indicate (possible) loss of data or a failure to check.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Finding is a single result of the checking-process.
+type Finding struct {
+	Kind     FindingKind
+	Severity Severity
+	// Path is the file-system path to which the finding applies.
+	Path string
+	// Id is the repository object to which the finding applies, if known.
+	Id string
+	// Fixed indicates that the issue was fixed during checking.
+	Fixed   bool
+	Message string
+}
+
+func (f *Finding) String() string {
+	var b strings.Builder
+	b.WriteString("[" + f.Severity.String() + "] " + f.Kind.String())
+	if f.Fixed {
+		b.WriteString(" (fixed)")
+	}
+	b.WriteString(": " + f.Message)
+	if f.Path != "" {
+		b.WriteString(" (" + f.Path + ")")
+	}
+	return b.String()
+}
+
+// ChangeOp is the type of file-system operation performed by the checking-process.
+type ChangeOp uint8
+
+const (
+	// ChangeRemove removes a file or symlink.
+	ChangeRemove ChangeOp = iota
+	// ChangeSymlink creates a symlink.
+	ChangeSymlink
+	// ChangeMkdir creates a directory.
+	ChangeMkdir
+	// ChangeWriteProperties (re)writes a properties-file.
+	ChangeWriteProperties
+	// ChangeRename renames a file.
+	ChangeRename
+)
+
+func (o ChangeOp) String() string {
+	switch o {
+	case ChangeRemove:
+		return "remove"
+	case ChangeSymlink:
+		return "symlink"
+	case ChangeMkdir:
+		return "mkdir"
+	case ChangeWriteProperties:
+		return "write properties"
+	case ChangeRename:
+		return "rename"
+	default:
+		return "unknown"
+	}
+}
+
+// Change is a file-system change, performed or planned, by the checking-process.
+type Change struct {
+	Op   ChangeOp
+	Path string
+	// Target is the symlink target, for ChangeSymlink, or the new path, for ChangeRename.
+	Target string
+}
+
+func (c *Change) String() string {
+	if c.Op == ChangeSymlink || c.Op == ChangeRename {
+		return c.Op.String() + " " + c.Path + " -> " + c.Target
+	}
+	return c.Op.String() + " " + c.Path
+}
+
+// CheckReport contains the findings of the checking-process.
+type CheckReport struct {
+	// DryRun indicates that changes were only planned, not applied. Findings marked as fixed, would be fixed.
+	DryRun   bool
+	Findings []Finding
+	// Changes lists the file-system changes, in order, that were made (or planned, in case of a dry-run).
+	Changes []Change
+	// Hashed is the number of objects whose content was hashed.
+	Hashed uint
+	// Cached is the number of objects whose content was not hashed, relying on a previous verification.
+	Cached uint
+}
+
+// add adds a finding to the report and logs it accordingly.
+func (c *CheckReport) add(f Finding) {
+	c.Findings = append(c.Findings, f)
+	if f.Severity == SeverityInfo && f.Fixed {
+		log.Debugln(strings_.CondText(c.DryRun, "(dry-run) ", "") + f.String())
+	} else {
+		log.Warnln(strings_.CondText(c.DryRun, "(dry-run) ", "") + f.String())
+	}
+}
+
+// Count counts the findings with at least the specified severity.
+func (c *CheckReport) Count(severity Severity) int {
+	var count int
+	for i := range c.Findings {
+		if c.Findings[i].Severity >= severity {
+			count++
+		}
+	}
+	return count
+}
+
+// CountFixed counts the findings that were fixed during checking.
+func (c *CheckReport) CountFixed() int {
+	var count int
+	for i := range c.Findings {
+		if c.Findings[i].Fixed {
+			count++
+		}
+	}
+	return count
+}
+
+// Unresolved returns the findings that were not fixed during checking.
+func (c *CheckReport) Unresolved() []Finding {
+	var unresolved []Finding
+	for _, f := range c.Findings {
+		if !f.Fixed {
+			unresolved = append(unresolved, f)
+		}
+	}
+	return unresolved
+}
+
+// checkTagsForObject verifies the tag-symlinks of an object against the tags recorded in its properties.
+// Missing symlinks for recorded tags are recreated, as are symlinks with an outdated target or a target that
+// does not exist. Foreign objects, and symlinks to other objects by the same name, are reported. Symlinks to
+// the object that are present in the file system but not recorded in the properties, are adopted into the
+// properties, such that tags applied through the file system are not lost. index is the tag-index of the
+// repository, see `readTagEntries`.
+func (r *Repo) checkTagsForObject(c *checker, index map[string]category, obj *RepoObj) {
+	for _, cat := range obj.Categories() {
+		for _, tag := range obj.Tags[cat] {
+			path := filepath.Join(r.location, tagdir(index, cat, tag), obj.Name)
+			relobjpath := r.linktarget(tagdepth(tag), obj.Id)
+			if info, err := os.Lstat(path); err == nil {
+				if info.Mode()&os.ModeSymlink == 0 {
+					// Foreign objects at tag locations are reported below.
+					continue
+				}
+				target, err := os.Readlink(path)
+				if err != nil {
+					c.add(Finding{Kind: KindForeignObject, Severity: SeverityWarning, Path: path, Id: obj.Id,
+						Message: "failed to query symlink for recorded tag: " + err.Error()})
+					continue
+				}
+				if target == relobjpath {
+					continue
+				}
+				if other := filepath.Base(target); other != obj.Id && os_.ExistsFile(r.repofilepath(other)) {
+					c.add(Finding{Kind: KindDuplicateTitle, Severity: SeverityWarning, Path: path, Id: obj.Id,
+						Message: "symlink for recorded tag is in use by another repo-object: " + other})
+					continue
+				}
+				// The symlink refers to the object by an outdated target, or to an object that does not exist.
+				if err := c.remove(path); err != nil {
+					c.add(Finding{Kind: KindBrokenSymlink, Severity: SeverityWarning, Path: path, Id: obj.Id,
+						Message: "failed to remove symlink for recorded tag with incorrect target: " + err.Error()})
+					continue
+				}
+				if err := c.symlink(relobjpath, path); err != nil {
+					c.add(Finding{Kind: KindBrokenSymlink, Severity: SeverityWarning, Path: path, Id: obj.Id,
+						Message: "failed to recreate symlink for recorded tag: " + err.Error()})
+					continue
+				}
+				c.add(Finding{Kind: KindBrokenSymlink, Severity: SeverityInfo, Path: path, Id: obj.Id, Fixed: true,
+					Message: "symlink for recorded tag with incorrect target '" + target + "' recreated"})
+				continue
+			}
+			if err := c.mkdirAll(filepath.Dir(path)); err != nil {
+				c.add(Finding{Kind: KindMissingSymlink, Severity: SeverityWarning, Path: path, Id: obj.Id,
+					Message: "failed to create tag-directory for recorded tag: " + err.Error()})
+				continue
+			}
+			if err := c.symlink(relobjpath, path); err != nil {
+				c.add(Finding{Kind: KindMissingSymlink, Severity: SeverityWarning, Path: path, Id: obj.Id,
+					Message: "failed to recreate symlink for recorded tag: " + err.Error()})
+				continue
+			}
+			c.add(Finding{Kind: KindMissingSymlink, Severity: SeverityInfo, Path: path, Id: obj.Id, Fixed: true,
+				Message: "missing symlink for recorded tag recreated"})
+		}
+	}
+	cats := maps.ExtractKeys(index)
+	slices.Sort(cats)
+	var adopted []string
+	for _, cat := range cats {
+		for _, t := range index[cat].tags {
+			path := filepath.Join(r.location, index[cat].dir, t.Path, obj.Name)
+			relobjpath := r.linktarget(tagdepth(t.Key), obj.Id)
+			if info, err := os.Lstat(path); err != nil {
+				continue
+			} else if info.Mode()&os.ModeSymlink == 0 {
+				c.add(Finding{Kind: KindForeignObject, Severity: SeverityWarning, Path: path, Id: obj.Id,
+					Message: "foreign object at tag location, not making changes"})
+				continue
+			} else if linkpath := builtin.Expect(os.Readlink(path)); linkpath != relobjpath {
+				log.Traceln("Tag symlink points to different repository-object. This will be fixed in different step of the checking-process.")
+				continue
+			}
+			if obj.addTag(cat, t.Key) {
+				adopted = append(adopted, path)
+			}
+		}
+	}
+	if len(adopted) == 0 {
+		return
+	}
+	err := c.writeProperties(obj)
+	for _, path := range adopted {
+		if err == nil {
+			c.add(Finding{Kind: KindUnrecordedTag, Severity: SeverityInfo, Path: path, Id: obj.Id, Fixed: true,
+				Message: "tag adopted from symlink into properties"})
+		} else {
+			c.add(Finding{Kind: KindUnrecordedTag, Severity: SeverityWarning, Path: path, Id: obj.Id,
+				Message: "failed to record tag from symlink in properties: " + err.Error()})
+		}
+	}
+}
+
+func (r *Repo) checkBadTags(c *checker) error {
+	collisions, err := findCollisions(r.location)
+	if err != nil {
+		return errors.Context(err, "failed to open repository root-directory for tags processing")
+	}
+	for _, col := range collisions {
+		c.add(Finding{Kind: KindTagCollision, Severity: SeverityWarning, Path: filepath.Join(r.location, col.path),
+			Message: "directory resolves to the same key as '" + col.other + "', its content is ignored; merge both directories"})
+	}
+	index, err := readTagEntries(r.location)
+	if err != nil {
+		return errors.Context(err, "failed to read tag-directories for tags processing")
+	}
+	cats := maps.ExtractKeys(index)
+	slices.Sort(cats)
+	for _, cat := range cats {
+		log.Traceln("Processing tag-category '" + index[cat].dir + "'…")
+		for _, t := range index[cat].tags {
+			log.Traceln("Processing tag '" + t.Key + "' in category '" + cat + "'…")
+			tagpath := filepath.Join(r.location, index[cat].dir, t.Path)
+			links, err := os.ReadDir(tagpath)
+			if err != nil {
+				c.add(Finding{Kind: KindFailure, Severity: SeverityWarning, Path: tagpath,
+					Message: "failed to read files in tag-directory: " + err.Error()})
+				continue
+			}
+			for _, link := range links {
+				if link.IsDir() {
+					// Nested tag-directories are processed separately.
+					continue
+				}
+				log.Traceln("Processing symlink '" + link.Name() + "'…")
+				linkpath := filepath.Join(tagpath, link.Name())
+				if _, ok := c.planned[linkpath]; ok {
+					// Symlinks that were (re)created or removed in the dry-run are up-to-date.
+					continue
+				}
+				if _, err := os.Stat(linkpath); err == nil {
+					relobjpath, err := os.Readlink(linkpath)
+					if err != nil {
+						c.add(Finding{Kind: KindForeignObject, Severity: SeverityWarning, Path: linkpath,
+							Message: "failed to read repo-object path from symlink: " + err.Error()})
+						continue
+					}
+					repoobj, err := r.openObject(filepath.Base(relobjpath))
+					if err != nil {
+						c.add(Finding{Kind: KindBrokenSymlink, Severity: SeverityWarning, Path: linkpath,
+							Id: filepath.Base(relobjpath), Message: "failed to open repo-object: " + err.Error()})
+						continue
+					}
+					if link.Name() != repoobj.Name {
+						expectedpath := filepath.Join(tagpath, repoobj.Name)
+						if !c.exists(expectedpath) {
+							if err := c.symlink(r.linktarget(tagdepth(t.Key), repoobj.Id), expectedpath); err == nil {
+								c.add(Finding{Kind: KindMissingSymlink, Severity: SeverityInfo, Path: expectedpath,
+									Id: repoobj.Id, Fixed: true, Message: "created symlink with correct name"})
+							} else {
+								c.add(Finding{Kind: KindMissingSymlink, Severity: SeverityWarning, Path: expectedpath,
+									Id: repoobj.Id, Message: "failed to create symlink with correct name: " + err.Error()})
+							}
+						} else {
+							log.Traceln("Symlink with correct name already exists.")
+						}
+						// Symlink with (most likely) outdated name. Can be removed, as we would already
+						// (re)create the missing symlink if we wouldn't find it at the expected name.
+						if err = c.remove(linkpath); err == nil {
+							c.add(Finding{Kind: KindMisnamedSymlink, Severity: SeverityInfo, Path: linkpath,
+								Id: repoobj.Id, Fixed: true, Message: "removed symlink with incorrect name"})
+						} else {
+							c.add(Finding{Kind: KindMisnamedSymlink, Severity: SeverityWarning, Path: linkpath,
+								Id: repoobj.Id, Message: "failed to remove symlink with incorrect name: " + err.Error()})
+						}
+					}
+				} else {
+					// Remove broken symlink.
+					if err := c.remove(linkpath); err == nil {
+						c.add(Finding{Kind: KindBrokenSymlink, Severity: SeverityInfo, Path: linkpath, Fixed: true,
+							Message: "removed broken symlink"})
+					} else {
+						c.add(Finding{Kind: KindBrokenSymlink, Severity: SeverityWarning, Path: linkpath,
+							Message: "failed to remove broken symlink: " + err.Error()})
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checksumResult is the result of hashing the content of a repository object.
+type checksumResult struct {
+	checksum string
+	err      error
+}
+
+func hashObject(algorithm, path string) checksumResult {
+	checksum, err := Hash(algorithm, path)
+	return checksumResult{checksum: hex.EncodeToString(checksum), err: err}
+}
+
+// isObjectEntry checks if a directory entry in the object-repository is (supposedly) a repository object.
+func isObjectEntry(e os.DirEntry) bool {
+	return e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") &&
+		!strings.HasSuffix(e.Name(), repoPropertiesSuffix) && !strings.HasPrefix(e.Name(), tempFilePrefix)
+}
+
+// hashJob is a repository object to be hashed, with the file characteristics at the time of scheduling.
+type hashJob struct {
+	name string
+	info os.FileInfo
+	// algorithm is the hash algorithm recorded for the object.
+	algorithm string
+}
+
+// hashObjects hashes the content of the specified objects using a bounded pool of workers. Zero workers
+// defaults to the number of CPUs.
+func (r *Repo) hashObjects(jobs []hashJob, workers uint) map[string]checksumResult {
+	if workers == 0 {
+		workers = uint(runtime.NumCPU())
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	checksums := make(map[string]checksumResult, len(jobs))
+	queue := make(chan hashJob)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				log.Traceln("Verifying content of repo-object…", j.name)
+				result := hashObject(j.algorithm, r.repofilepath(j.name))
+				mu.Lock()
+				checksums[j.name] = result
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+	return checksums
+}
+
+// recordVerifications records the results of hashing in the verification cache.
+func recordVerifications(cache map[string]verification, jobs []hashJob, checksums map[string]checksumResult) {
+	now := time.Now()
+	for _, j := range jobs {
+		if result := checksums[j.name]; result.err == nil {
+			cache[j.name] = newVerification(j.info, now, result.checksum == j.name)
+		}
+	}
+}
+
+// verifyObjects hashes the content of repository objects. Unless a full check is requested, objects that were
+// successfully verified before, are unchanged since, and whose verification is not outdated, are not hashed
+// again. The objects are determined under shared lock, the content is hashed without holding the lock, such
+// that other operations are not held up for the duration of hashing. Results are collected per object, such
+// that processing of the results happens in deterministic order, independent of the number of workers. The
+// verifications are returned for recording in the verification cache, see `updateVerificationCache`.
+func (r *Repo) verifyObjects(opts *CheckOptions, report *CheckReport) (map[string]checksumResult, map[string]verification, error) {
+	unlock, err := r.lock(LockShared)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := r.readRepoEntries()
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	cache := readVerificationCache(r.location)
+	updated := map[string]verification{}
+	cached := map[string]checksumResult{}
+	var jobs []hashJob
+	now := time.Now()
+	for _, e := range entries {
+		if !r.isObjectEntry(e) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			// Leave it to the checking-process to report the problem.
+			continue
+		}
+		if v, ok := cache[e.Name()]; ok && !opts.Full && v.ok && v.unchanged(info) &&
+			(opts.MaxAge == 0 || now.Sub(v.verified) < opts.MaxAge) {
+			log.Traceln("Skipping verification of unchanged repo-object…", e.Name())
+			cached[e.Name()] = checksumResult{checksum: e.Name()}
+			updated[e.Name()] = v
+			continue
+		}
+		jobs = append(jobs, hashJob{name: e.Name(), info: info, algorithm: r.objectHash(e.Name())})
+	}
+	unlock()
+	checksums := r.hashObjects(jobs, opts.Workers)
+	recordVerifications(updated, jobs, checksums)
+	report.Hashed, report.Cached = uint(len(jobs)), uint(len(cached))
+	maps.MergeInto(checksums, cached)
+	return checksums, updated, nil
+}
+
+// CheckOptions configures the checking-process.
+type CheckOptions struct {
+	// DryRun determines all changes that checking would make, without applying any of them.
+	DryRun bool
+	// Workers is the number of workers that hash content in parallel. Zero defaults to the number of CPUs.
+	// For storage with high latency, more workers than CPUs may be beneficial.
+	Workers uint
+	// Full hashes all objects, regardless of previous verifications.
+	Full bool
+	// MaxAge is the age after which a previous verification is outdated, such that the object is hashed
+	// again. Zero means that previous verifications do not become outdated.
+	MaxAge time.Duration
+	// Plan is the list of changes of a preceding dry-run, e.g. as previewed for confirmation. If set, the
+	// changes are made only if they are identical to the plan, otherwise `ErrPlanChanged` is returned.
+	Plan []Change
+}
+
+// ErrPlanChanged indicates that the changes of a check differ from the plan, see `CheckOptions.Plan`.
+var ErrPlanChanged = errors.NewStringError("changes differ from the planned changes")
+
+// Check checks the repository and fixes issues where possible. The returned report lists all findings. An
+// error is returned only if checking could not be completed. Checking refuses to make changes to a directory
+// that is not (or no longer) marked as repository.
+func (r *Repo) Check(opts CheckOptions) (CheckReport, error) {
+	var report = CheckReport{DryRun: opts.DryRun}
+	c := &checker{repo: r, report: &report, planned: map[string]bool{}}
+
+	if !opts.DryRun && !isRepository(r.location) {
+		return report, errors.Context(ErrNotRepository, r.location)
+	}
+
+	log.Infoln("Checking repository…")
+	defer log.Infoln("Finished repository check.")
+
+	// Verifying content is the lengthy part of checking. It does not hold the lock while hashing, such that
+	// other operations can proceed in the mean time. Changes are made afterwards, under exclusive lock.
+	checksums, verifications, err := r.verifyObjects(&opts, &report)
+	if err != nil {
+		return report, err
+	}
+
+	mode := LockExclusive
+	if opts.DryRun {
+		mode = LockShared
+	}
+	unlock, err := r.lock(mode)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+	if !opts.DryRun {
+		if err := r.updateVerificationCache(verifications); err != nil {
+			log.Warnln("Failed to write verification cache:", err.Error())
+		}
+	}
+
+	if opts.Plan != nil {
+		// The plan is verified under the same lock under which the changes are made, such that only the
+		// previewed changes are applied.
+		preview := CheckReport{DryRun: true}
+		if err := r.checkRepository(&checker{repo: r, report: &preview, planned: map[string]bool{}}, checksums); err != nil {
+			return report, err
+		}
+		if !slices.Equal(preview.Changes, opts.Plan) {
+			return report, ErrPlanChanged
+		}
+	}
+	if err := r.checkRepository(c, checksums); err != nil {
+		return report, err
+	}
+
+	if !opts.DryRun {
+		// Checking makes changes to tags and tag-symlinks, therefore refresh the categories and tag-index.
+		if err := r.reload(); err != nil {
+			c.add(Finding{Kind: KindFailure, Severity: SeverityWarning, Message: "failed to reload tags: " + err.Error()})
+		}
+	}
+	return report, nil
+}
+
+// checkRepository checks the repository entries, titles and tags, making changes through c. The caller is
+// expected to hold the lock.
+func (r *Repo) checkRepository(c *checker, checksums map[string]checksumResult) error {
+	var entries []os.DirEntry
+	var repoentries []repoEntry
+	var err error
+	if repoentries, err = r.readRepoEntries(); err != nil {
+		return err
+	}
+	// Remove abandoned temporary files of the repository configuration and verification cache.
+	if entries, err = os.ReadDir(r.location); err != nil {
+		return errors.Context(err, "failed to open repository root-directory")
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), tempFilePrefix) {
+			c.removeTemporaryFile(filepath.Join(r.location, e.Name()))
+		}
+	}
+	// Objects that are present, but misplaced, must not have their properties removed as orphaned.
+	misplaced := map[string]struct{}{}
+	for _, e := range repoentries {
+		if !r.placed(e) {
+			misplaced[e.Name()] = struct{}{}
+		}
+	}
+	// The tag-directories are indexed once, for verification of the tag-symlinks of each object.
+	index, err := readTagEntries(r.location)
+	if err != nil {
+		return errors.Context(err, "failed to read tag-directories for tags processing")
+	}
+	for _, e := range repoentries {
+		log.Traceln("Processing repo-entry…", e.Name())
+		path := e.path
+		// Any non-regular file-system object is a foreign entity.
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			c.add(Finding{Kind: KindForeignObject, Severity: SeverityWarning, Path: path,
+				Message: "foreign object in object-repository"})
+			continue
+		}
+		// Misplaced objects and properties are left untouched, as the layout may be in process of conversion.
+		if !r.placed(e) && !strings.HasPrefix(e.Name(), tempFilePrefix) {
+			c.add(Finding{Kind: KindMisplacedObject, Severity: SeverityWarning, Path: path,
+				Id:      strings.TrimSuffix(e.Name(), repoPropertiesSuffix),
+				Message: "not at location prescribed by '" + r.config.Layout + "' layout (use 'relayout' to move into place)"})
+			continue
+		}
+		// Check if properties-file has a corresponding repository object.
+		if strings.HasSuffix(e.Name(), repoPropertiesSuffix) {
+			// properties-files are processed in conjuction with the corresponding binary file.
+			id := strings.TrimSuffix(e.Name(), repoPropertiesSuffix)
+			if _, ok := misplaced[id]; ok {
+				c.add(Finding{Kind: KindMisplacedObject, Severity: SeverityWarning, Path: path, Id: id,
+					Message: "corresponding object is misplaced, not making changes"})
+			} else if info, err := os.Stat(r.repofilepath(id)); err != nil {
+				if err := c.remove(path); err != nil {
+					c.add(Finding{Kind: KindOrphanedProperties, Severity: SeverityWarning, Path: path, Id: id,
+						Message: "failed to remove orphaned properties-file: " + err.Error()})
+				} else {
+					c.add(Finding{Kind: KindOrphanedProperties, Severity: SeverityInfo, Path: path, Id: id,
+						Fixed: true, Message: "removed orphaned properties-file"})
+				}
+			} else if info.Mode()&os.ModeType != 0 {
+				c.add(Finding{Kind: KindForeignObject, Severity: SeverityWarning, Path: r.repofilepath(id), Id: id,
+					Message: "corresponding file-system object is not a regular file"})
+			}
+			continue
+		}
+		// Remove abandoned temporary repository objects and properties-files.
+		if strings.HasPrefix(e.Name(), tempFilePrefix) {
+			c.removeTemporaryFile(path)
+			continue
+		}
+		// Comparing file content checksum with binary-object name.
+		result, ok := checksums[e.Name()]
+		if !ok || errors.Is(result.err, os.ErrNotExist) {
+			// Object was acquired, or moved, after content verification.
+			result = hashObject(r.objectHash(e.Name()), path)
+		}
+		if result.err != nil {
+			c.add(Finding{Kind: KindFailure, Severity: SeverityError, Path: path, Id: e.Name(),
+				Message: "failed to hash repo-object: " + result.err.Error()})
+		} else if e.Name() != result.checksum {
+			c.add(Finding{Kind: KindCorruption, Severity: SeverityError, Path: path, Id: e.Name(),
+				Message: "checksum does not match, possible corruption (checksum: " + result.checksum + ")"})
+		}
+		// Checking file-permissions for writability.
+		if info, err := os.Stat(path); err == nil && info.Mode()&0o222 != 0 {
+			c.add(Finding{Kind: KindWritableObject, Severity: SeverityWarning, Path: path, Id: e.Name(),
+				Message: "repository-object is writable, which should not be the case for immutable objects"})
+		}
+		// Checking characteristics of file properties.
+		if info, err := os.Stat(path + repoPropertiesSuffix); err != nil {
+			c.add(Finding{Kind: KindMissingProperties, Severity: SeverityError, Path: path + repoPropertiesSuffix,
+				Id: e.Name(), Message: "properties-file is missing"})
+		} else if info.Mode()&os.ModeType != 0 {
+			c.add(Finding{Kind: KindMissingProperties, Severity: SeverityError, Path: path + repoPropertiesSuffix,
+				Id: e.Name(), Message: "properties-file is not a regular file"})
+		} else if o, err := r.openObject(e.Name()); err != nil {
+			c.add(Finding{Kind: KindInvalidProperties, Severity: SeverityError, Path: path + repoPropertiesSuffix,
+				Id: e.Name(), Message: "failed to parse properties: " + err.Error()})
+		} else {
+			if o.Id != e.Name() {
+				c.add(Finding{Kind: KindInvalidProperties, Severity: SeverityError, Path: path + repoPropertiesSuffix,
+					Id: e.Name(), Message: "hash property does not match object: " + o.Id})
+			}
+			if err := o.Meta.Validate(); err != nil {
+				c.add(Finding{Kind: KindInvalidProperties, Severity: SeverityWarning, Path: path + repoPropertiesSuffix,
+					Id: e.Name(), Message: "invalid metadata: " + err.Error()})
+			}
+			if err := r.schema.Validate(&o.Props); err != nil {
+				c.add(Finding{Kind: KindSchemaViolation, Severity: SeverityWarning, Path: path + repoPropertiesSuffix,
+					Id: e.Name(), Message: err.Error()})
+			}
+			titlepath := filepath.Join(r.location, subdirTitles, o.Name)
+			if info, err := os.Lstat(titlepath); err != nil {
+				// Create symlink when one does not exist under the correct name as stated in the properties.
+				// Next we will remove symlinks that refer to repo-objects that have a different name-prop.
+				if err := c.symlink(r.linktarget(1, e.Name()), titlepath); err != nil {
+					c.add(Finding{Kind: KindMissingSymlink, Severity: SeverityWarning, Path: titlepath, Id: e.Name(),
+						Message: "failed to create symlink in document titles: " + err.Error()})
+				} else {
+					c.add(Finding{Kind: KindMissingSymlink, Severity: SeverityInfo, Path: titlepath, Id: e.Name(),
+						Fixed: true, Message: "missing symlink in document titles recreated"})
+				}
+			} else if info.Mode()&os.ModeSymlink == 0 {
+				c.add(Finding{Kind: KindForeignObject, Severity: SeverityWarning, Path: titlepath, Id: e.Name(),
+					Message: "a foreign file-system object was found where a symlink to a repo-object was expected"})
+			} else if targetpath, err := os.Readlink(titlepath); err == nil && filepath.Base(targetpath) != e.Name() {
+				c.add(Finding{Kind: KindDuplicateTitle, Severity: SeverityWarning, Path: titlepath, Id: e.Name(),
+					Message: "title is in use by another repo-object: " + filepath.Base(targetpath)})
+			}
+			// Verify symlinks for tags that are expected for this specific object.
+			r.checkTagsForObject(c, index, &o)
+		}
+	}
+
+	if entries, err = os.ReadDir(filepath.Join(r.location, subdirTitles)); err != nil {
+		return errors.Context(err, "failed to open directory with titles links")
+	}
+	for _, e := range entries {
+		log.Traceln("Processing titles-entry…", e.Name())
+		path := filepath.Join(r.location, subdirTitles, e.Name())
+		if targetpath, err := os.Readlink(path); err != nil {
+			c.add(Finding{Kind: KindForeignObject, Severity: SeverityWarning, Path: path,
+				Message: "failed to query symlink: " + err.Error()})
+		} else if obj, err := r.openObject(filepath.Base(targetpath)); err != nil {
+			// TODO should I be checking that linkpath has characteristics of repo-object before drawing conclusions?
+			if err := c.remove(path); err != nil {
+				c.add(Finding{Kind: KindBrokenSymlink, Severity: SeverityWarning, Path: path,
+					Message: "failed to delete broken symlink in titles: " + err.Error()})
+				continue
+			}
+			c.add(Finding{Kind: KindBrokenSymlink, Severity: SeverityInfo, Path: path, Fixed: true,
+				Message: "removed broken symlink in titles"})
+		} else if obj.Name != e.Name() {
+			// Previously, we created symlinks when they don't exist at expected name. Now we remove existing
+			// symlinks which refer to repo-objects with a different name.
+			if err := c.remove(path); err != nil {
+				c.add(Finding{Kind: KindMisnamedSymlink, Severity: SeverityWarning, Path: path, Id: obj.Id,
+					Message: "failed to remove titles symlink with incorrect name: " + err.Error()})
+				continue
+			}
+			c.add(Finding{Kind: KindMisnamedSymlink, Severity: SeverityInfo, Path: path, Id: obj.Id, Fixed: true,
+				Message: "removed titles symlink with incorrect name"})
+		}
+	}
+
+	if err := r.checkBadTags(c); err != nil {
+		c.add(Finding{Kind: KindFailure, Severity: SeverityError, Message: "failed to check tags: " + err.Error()})
+	}
+	return nil
+}
+
+// checker performs the changes of the checking-process, or only records them in case of a dry-run.
+type checker struct {
+	repo   *Repo
+	report *CheckReport
+	// planned records, in case of a dry-run, whether paths exist after the planned creations and removals.
+	planned map[string]bool
+}
+
+func (c *checker) add(f Finding) {
+	c.report.add(f)
+}
+
+// exists checks if path exists, taking into account the planned changes in case of a dry-run.
+func (c *checker) exists(path string) bool {
+	if exists, ok := c.planned[path]; ok {
+		return exists
+	}
+	return os_.Exists(path)
+}
+
+func (c *checker) remove(path string) error {
+	c.report.Changes = append(c.report.Changes, Change{Op: ChangeRemove, Path: path})
+	if c.report.DryRun {
+		c.planned[path] = false
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// removeTemporaryFile removes a temporary file that was abandoned, e.g. due to an interrupted write. Temporary
+// files are written under lock, so any temporary file that is found during checking is abandoned.
+func (c *checker) removeTemporaryFile(path string) {
+	if err := c.remove(path); err != nil {
+		c.add(Finding{Kind: KindTemporaryFile, Severity: SeverityWarning, Path: path,
+			Message: "failed to remove old temporary file: " + err.Error()})
+	} else {
+		c.add(Finding{Kind: KindTemporaryFile, Severity: SeverityInfo, Path: path, Fixed: true,
+			Message: "removed temporary file"})
+	}
+}
+
+func (c *checker) symlink(target, path string) error {
+	c.report.Changes = append(c.report.Changes, Change{Op: ChangeSymlink, Path: path, Target: target})
+	if c.report.DryRun {
+		c.planned[path] = true
+		return nil
+	}
+	return os.Symlink(target, path)
+}
+
+func (c *checker) mkdirAll(path string) error {
+	if c.exists(path) {
+		return nil
+	}
+	c.report.Changes = append(c.report.Changes, Change{Op: ChangeMkdir, Path: path})
+	if c.report.DryRun {
+		c.planned[path] = true
+		return nil
+	}
+	return os.MkdirAll(path, 0o700)
+}
+
+func (c *checker) writeProperties(obj *RepoObj) error {
+	c.report.Changes = append(c.report.Changes, Change{Op: ChangeWriteProperties, Path: c.repo.repofilepath(obj.Id) + repoPropertiesSuffix})
+	if c.report.DryRun {
+		return nil
+	}
+	return c.repo.writeProperties(obj)
+}
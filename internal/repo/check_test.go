@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	os_ "github.com/cobratbq/goutils/std/os"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func countFindings(report *CheckReport, kind FindingKind, fixed bool) int {
+	var count int
+	for _, f := range report.Findings {
+		if f.Kind == kind && f.Fixed == fixed {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCheckTagSymlinks(t *testing.T) {
+	testdata := []struct {
+		name string
+		// corrupt replaces the tag-symlink at path for the tagged object id, given the id of another object.
+		corrupt func(r *Repo, path, id, other string) error
+		kind    FindingKind
+		fixed   bool
+	}{
+		{"regular file", func(r *Repo, path, id, other string) error {
+			return os.WriteFile(path, []byte("foreign"), 0o600)
+		}, KindForeignObject, false},
+		{"outdated target", func(r *Repo, path, id, other string) error {
+			return os.Symlink(r.linktarget(1, id), path)
+		}, KindBrokenSymlink, true},
+		{"missing object", func(r *Repo, path, id, other string) error {
+			return os.Symlink(r.linktarget(2, "0123456789abcdef"), path)
+		}, KindBrokenSymlink, true},
+		{"other object", func(r *Repo, path, id, other string) error {
+			return os.Symlink(r.linktarget(2, other), path)
+		}, KindDuplicateTitle, false},
+	}
+	for _, d := range testdata {
+		r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{Starters: []string{"topic/crypto"}})
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.name)
+		obj, _, err := r.Acquire(strings.NewReader("tagged"), "tagged.pdf")
+		assert.Nil(t, err)
+		assert.Nil(t, r.Tag("topic", "crypto", &obj))
+		other, _, err := r.Acquire(strings.NewReader("other"), "other.pdf")
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.name)
+		path := filepath.Join(r.location, "topic", "crypto", obj.Name)
+		assert.Nil(t, os.Remove(path))
+		assert.Nil(t, d.corrupt(r, path, obj.Id, other.Id))
+		assert.StopOnFailure(t, d.name)
+		// The dry-run reports the finding and plans the changes that are subsequently applied.
+		dryrun, err := r.Check(CheckOptions{DryRun: true})
+		assert.Nil(t, err)
+		assert.True(t, countFindings(&dryrun, d.kind, d.fixed) > 0)
+		report, err := r.Check(CheckOptions{Plan: dryrun.Changes})
+		assert.Nil(t, err)
+		assert.True(t, countFindings(&report, d.kind, d.fixed) > 0)
+		if d.fixed {
+			target, err := os.Readlink(path)
+			assert.Nil(t, err)
+			assert.Equal(t, r.linktarget(2, obj.Id), target)
+			recheck, err := r.Check(CheckOptions{DryRun: true})
+			assert.Nil(t, err)
+			assert.Equal(t, 0, len(recheck.Changes))
+		} else if d.kind == KindForeignObject {
+			data, err := os.ReadFile(path)
+			assert.Nil(t, err)
+			assert.Equal(t, "foreign", string(data))
+		}
+		assert.LogOnFailure(t, d.name)
+	}
+}
+
+func TestCheckTemporaryFiles(t *testing.T) {
+	testdata := []struct {
+		name   string
+		layout string
+		// dir returns the directory in which a temporary file is abandoned, given the id of an object.
+		dir func(r *Repo, id string) string
+	}{
+		{"root", LayoutFlat, func(r *Repo, id string) string { return r.location }},
+		{"object-repository", LayoutFlat, func(r *Repo, id string) string { return r.repofilepath("") }},
+		{"shard-directory", LayoutSharded, func(r *Repo, id string) string { return filepath.Dir(r.repofilepath(id)) }},
+	}
+	for _, d := range testdata {
+		r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{Layout: d.layout})
+		assert.Nil(t, err)
+		obj, _, err := r.Acquire(strings.NewReader("x"), "x.pdf")
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.name)
+		tempf, err := os.CreateTemp(d.dir(r, obj.Id), tempFilePrefix)
+		assert.Nil(t, err)
+		assert.Nil(t, tempf.Close())
+		assert.StopOnFailure(t, d.name)
+		dryrun, err := r.Check(CheckOptions{DryRun: true})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, countFindings(&dryrun, KindTemporaryFile, true))
+		assert.True(t, os_.ExistsFile(tempf.Name()))
+		report, err := r.Check(CheckOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, countFindings(&report, KindTemporaryFile, true))
+		assert.False(t, os_.Exists(tempf.Name()))
+		assert.LogOnFailure(t, d.name)
+	}
+}
+
+// snapshot captures the file system tree at location, with the content of files and the targets of symlinks.
+// The lock-file is excluded, as it is created upon first use.
+func snapshot(t *testing.T, location string) map[string]string {
+	tree := map[string]string{}
+	assert.Nil(t, filepath.WalkDir(location, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case path == filepath.Join(location, lockFilename):
+		case d.Type()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			tree[path] = "symlink:" + target
+			return err
+		case d.IsDir():
+			tree[path] = "dir"
+		default:
+			data, err := os.ReadFile(path)
+			tree[path] = "file:" + string(data)
+			return err
+		}
+		return nil
+	}))
+	return tree
+}
+
+func TestCheckDryRun(t *testing.T) {
+	testdata := []struct {
+		name string
+		// corrupt damages the repository, given the tagged object.
+		corrupt func(r *Repo, obj *RepoObj) error
+	}{
+		{"missing title", func(r *Repo, obj *RepoObj) error {
+			return os.Remove(filepath.Join(r.location, subdirTitles, obj.Name))
+		}},
+		{"misnamed title", func(r *Repo, obj *RepoObj) error {
+			return os.Rename(filepath.Join(r.location, subdirTitles, obj.Name), filepath.Join(r.location, subdirTitles, "old.pdf"))
+		}},
+		{"broken title", func(r *Repo, obj *RepoObj) error {
+			return os.Symlink(r.linktarget(1, "0123456789abcdef"), filepath.Join(r.location, subdirTitles, "broken.pdf"))
+		}},
+		{"missing tag", func(r *Repo, obj *RepoObj) error {
+			return os.Remove(filepath.Join(r.location, "topic", "crypto", obj.Name))
+		}},
+		{"misnamed tag", func(r *Repo, obj *RepoObj) error {
+			return os.Rename(filepath.Join(r.location, "topic", "crypto", obj.Name), filepath.Join(r.location, "topic", "crypto", "old.pdf"))
+		}},
+		{"unrecorded tag", func(r *Repo, obj *RepoObj) error {
+			return os.Symlink(r.linktarget(2, obj.Id), filepath.Join(r.location, "topic", "security", obj.Name))
+		}},
+		{"missing tag-directory", func(r *Repo, obj *RepoObj) error {
+			return os.RemoveAll(filepath.Join(r.location, "topic", "crypto"))
+		}},
+		{"orphaned properties", func(r *Repo, obj *RepoObj) error {
+			return os.WriteFile(r.repofilepath("0123456789abcdef")+repoPropertiesSuffix, []byte("custom=1\n"), 0o600)
+		}},
+		{"temporary file", func(r *Repo, obj *RepoObj) error {
+			return os.WriteFile(r.repofilepath(tempFilePrefix+"123"), nil, 0o600)
+		}},
+	}
+	for _, d := range testdata {
+		r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{Starters: []string{"topic/crypto", "topic/security"}})
+		assert.Nil(t, err)
+		obj, _, err := r.Acquire(strings.NewReader("tagged"), "tagged.pdf")
+		assert.Nil(t, err)
+		assert.Nil(t, r.Tag("topic", "crypto", &obj))
+		assert.StopOnFailure(t, d.name)
+		// Checking repairs the titles, such that the repository is consistent before it is damaged.
+		_, err = r.Check(CheckOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, d.corrupt(r, &obj))
+		assert.StopOnFailure(t, d.name)
+		before := snapshot(t, r.location)
+		dryrun, err := r.Check(CheckOptions{DryRun: true})
+		assert.Nil(t, err)
+		assert.True(t, dryrun.DryRun)
+		assert.True(t, len(dryrun.Changes) > 0)
+		assert.True(t, dryrun.CountFixed() > 0)
+		assert.Equal(t, len(before), len(snapshot(t, r.location)))
+		for path, entry := range snapshot(t, r.location) {
+			assert.Equal(t, before[path], entry)
+		}
+		// A repository that changed after the dry-run is not changed according to the outdated plan.
+		assert.Nil(t, os.WriteFile(filepath.Join(r.location, subdirRepo, tempFilePrefix+"new"), nil, 0o600))
+		_, err = r.Check(CheckOptions{Plan: dryrun.Changes})
+		assert.IsError(t, ErrPlanChanged, err)
+		assert.Nil(t, os.Remove(filepath.Join(r.location, subdirRepo, tempFilePrefix+"new")))
+		assert.Equal(t, len(before), len(snapshot(t, r.location)))
+		// Applying makes exactly the planned changes, after which the repository is consistent.
+		report, err := r.Check(CheckOptions{Plan: dryrun.Changes})
+		assert.Nil(t, err)
+		assert.False(t, report.DryRun)
+		assert.SlicesEqual(t, dryrun.Changes, report.Changes)
+		assert.Equal(t, len(dryrun.Findings), len(report.Findings))
+		assert.Equal(t, dryrun.CountFixed(), report.CountFixed())
+		recheck, err := r.Check(CheckOptions{DryRun: true})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(recheck.Changes))
+		assert.Equal(t, 0, len(recheck.Findings))
+		opened, err := r.OpenObject(obj.Id)
+		assert.Nil(t, err)
+		assert.True(t, opened.HasTag("topic", "crypto"))
+		assert.LogOnFailure(t, d.name)
+	}
+}
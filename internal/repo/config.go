@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+	os_ "github.com/cobratbq/goutils/std/os"
+)
+
+const (
+	// configFilename is the name of the repository marker/configuration file in the repository root.
+	configFilename = ".doclib"
+	// configVersion is the current format version of the repository.
+	configVersion = "2"
+	// configVersionOriginal is the format version of repositories that predate the repository marker-file.
+	configVersionOriginal = "0"
+	cfgVersion            = "version"
+	cfgHash               = "hash"
+	cfgLayout             = "layout"
+	cfgImplyAncestors     = "implyancestors"
+	cfgCreated            = "created"
+)
+
+// ErrNotRepository indicates that a directory is not marked as a repository.
+var ErrNotRepository = errors.NewStringError("not a repository: marker-file '" + configFilename + "' is missing")
+
+// ErrAlreadyRepository indicates that a directory is already marked as a repository.
+var ErrAlreadyRepository = errors.NewStringError("already a repository")
+
+// Config is the repository configuration, as stored in the repository marker-file.
+type Config struct {
+	// Version is the format version of the repository.
+	Version string
+	// Hash is the hash algorithm used for repository objects.
+	Hash string
+	// Layout is the layout of objects in the object-repository directory.
+	Layout string
+	// ImplyAncestors indicates that tagging with a nested tag implies tagging with its ancestors.
+	ImplyAncestors bool
+	// Created is the moment of creation (or adoption) of the repository.
+	Created time.Time
+	// Props contains any configuration that is not otherwise represented, in order of appearance.
+	Props Properties
+}
+
+func newConfig() Config {
+	return Config{Version: configVersion, Hash: HashBLAKE2b, Layout: LayoutFlat, Created: time.Now().UTC().Truncate(time.Second)}
+}
+
+func configpath(location string) string {
+	return filepath.Join(location, configFilename)
+}
+
+// isRepository checks whether location contains the repository marker-file.
+func isRepository(location string) bool {
+	return os_.ExistsFile(configpath(location))
+}
+
+func readConfig(location string) (Config, error) {
+	props, err := readPropertiesFile(configpath(location))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Config{}, errors.Context(ErrNotRepository, location)
+		}
+		return Config{}, errors.Context(err, "failed to parse repository configuration")
+	}
+	// Repositories predating format version 2 do not record the layout, and have the flat layout.
+	var cfg = Config{Layout: LayoutFlat}
+	var anchor string
+	for _, p := range props {
+		switch p[0] {
+		case cfgVersion:
+			if !supportedVersion(p[1]) {
+				return Config{}, errors.Context(errors.ErrUnsupported, "repository format version: "+p[1])
+			}
+			cfg.Version = p[1]
+		case cfgHash:
+			if !supportedHash(p[1]) {
+				return Config{}, errors.Context(errors.ErrUnsupported, "hash algorithm: "+p[1])
+			}
+			cfg.Hash = p[1]
+		case cfgLayout:
+			if !supportedLayout(p[1]) {
+				return Config{}, errors.Context(errors.ErrUnsupported, "layout: "+p[1])
+			}
+			cfg.Layout = p[1]
+		case cfgImplyAncestors:
+			if cfg.ImplyAncestors, err = strconv.ParseBool(p[1]); err != nil {
+				return Config{}, errors.Context(err, "failed to parse configuration '"+cfgImplyAncestors+"'")
+			}
+		case cfgCreated:
+			if cfg.Created, err = time.Parse(time.RFC3339, p[1]); err != nil {
+				return Config{}, errors.Context(err, "failed to parse creation time of repository")
+			}
+		default:
+			cfg.Props.add(p[0], p[1], anchor)
+			continue
+		}
+		anchor = p[0]
+	}
+	if cfg.Version == "" || cfg.Hash == "" {
+		return Config{}, errors.Context(errors.ErrIllegal, "repository configuration is incomplete")
+	}
+	return cfg, nil
+}
+
+func writeConfig(location string, cfg *Config) error {
+	var buffer = []byte(cfgVersion + "=" + cfg.Version + "\n" + cfgHash + "=" + cfg.Hash + "\n" + cfgLayout + "=" + cfg.Layout + "\n" + cfgImplyAncestors + "=" + strconv.FormatBool(cfg.ImplyAncestors) + "\n" + cfgCreated + "=" + cfg.Created.Format(time.RFC3339) + "\n")
+	buffer = cfg.Props.appendProperties(nil, buffer)
+	return writeFileAtomic(configpath(location), buffer, 0o600)
+}
+
+// validCategoryName checks whether name is acceptable as name for a category or tag directory.
+func validCategoryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, string(propTags0IllegalChars)) && !isStandardDir(name)
+}
+
+// InitOptions configures a new repository.
+type InitOptions struct {
+	// Hash is the hash algorithm that identifies objects. Defaults to `HashBLAKE2b`.
+	Hash string
+	// Layout is the layout of objects in the object-repository. Defaults to `LayoutFlat`.
+	Layout string
+	// ImplyAncestors configures that tagging with a nested tag implies tagging with its ancestors.
+	ImplyAncestors bool
+	// Starters are the initial categories and tags, specified as `<category>` or `<category>/<tag>`, where tag
+	// may be nested, e.g. `topic/programming/go`.
+	Starters []string
+}
+
+// InitRepository initializes a new repository at location, creating the directory if necessary.
+func InitRepository(location string, opts InitOptions) (*Repo, error) {
+	if isRepository(location) {
+		return nil, errors.Context(ErrAlreadyRepository, location)
+	}
+	cfg := newConfig()
+	if opts.Hash != "" {
+		if !supportedHash(opts.Hash) {
+			return nil, errors.Context(errors.ErrUnsupported, "hash algorithm: "+opts.Hash)
+		}
+		cfg.Hash = opts.Hash
+	}
+	if opts.Layout != "" {
+		if !supportedLayout(opts.Layout) {
+			return nil, errors.Context(errors.ErrUnsupported, "layout: "+opts.Layout)
+		}
+		cfg.Layout = opts.Layout
+	}
+	cfg.ImplyAncestors = opts.ImplyAncestors
+	starters := opts.Starters
+	for _, s := range starters {
+		cat, tag, hastag := strings.Cut(s, "/")
+		if !validCategoryName(cat) || hastag && !validTagPath(tag) {
+			return nil, errors.Context(errors.ErrIllegal, "invalid category or tag: "+s)
+		}
+	}
+	if err := os.MkdirAll(location, 0o700); err != nil {
+		return nil, errors.Context(err, "failed to create repository directory")
+	}
+	for _, subdir := range []string{subdirRepo, subdirTitles} {
+		if err := os.MkdirAll(filepath.Join(location, subdir), 0o700); err != nil {
+			return nil, errors.Context(err, "failed to create directory '"+subdir+"'")
+		}
+	}
+	for _, s := range starters {
+		if err := os.MkdirAll(filepath.Join(location, s), 0o700); err != nil {
+			return nil, errors.Context(err, "failed to create category or tag: "+s)
+		}
+	}
+	if err := writeConfig(location, &cfg); err != nil {
+		return nil, errors.Context(err, "failed to write repository marker-file")
+	}
+	log.Infoln("Initialized repository at:", location)
+	return OpenRepository(location)
+}
+
+// adoptedConfig returns the configuration for a directory that is adopted as repository. Directories without
+// marker-file predate format versioning, therefore are marked with the original format version such that the
+// repository is upgraded through migration.
+func adoptedConfig() Config {
+	cfg := newConfig()
+	cfg.Version = configVersionOriginal
+	return cfg
+}
+
+// AdoptRepository marks an existing directory as repository, then opens it. Adopting is needed for
+// directories that were in use as repository before the marker-file was introduced. An adopted repository
+// must be migrated before use, in which case `ErrMigrationRequired` is returned.
+func AdoptRepository(location string) (*Repo, error) {
+	if !os_.ExistsIsDirectory(location) {
+		return nil, errors.Context(errors.ErrIllegal, "not a directory: "+location)
+	}
+	if isRepository(location) {
+		return OpenRepository(location)
+	}
+	cfg := adoptedConfig()
+	if err := writeConfig(location, &cfg); err != nil {
+		return nil, errors.Context(err, "failed to write repository marker-file")
+	}
+	log.Infoln("Adopted directory as repository:", location)
+	return OpenRepository(location)
+}
@@ -0,0 +1,251 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+)
+
+// CSLItem is an item of a CSL-JSON export, e.g. from Zotero, including the extensions for attachments, tags and
+// collections as exported by Zotero's Better BibTeX.
+type CSLItem struct {
+	ID        cslText   `json:"id"`
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Author    []CSLName `json:"author"`
+	Issued    CSLDate   `json:"issued"`
+	Publisher string    `json:"publisher"`
+	DOI       string    `json:"DOI"`
+	ISBN      string    `json:"ISBN"`
+	URL       string    `json:"URL"`
+	Language  string    `json:"language"`
+	Note      string    `json:"note"`
+	// Keyword contains the tags, separated by comma, as standardized by CSL.
+	Keyword string `json:"keyword"`
+	// Tags contains the tags, either as names or as objects `{"tag": <name>}`.
+	Tags []cslTag `json:"tags"`
+	// Collections contains the names or paths, e.g. `Research/Cryptography`, of the collections of the item.
+	Collections []string `json:"collections"`
+	// File contains the paths of attachments, separated by semicolon.
+	File        string          `json:"file"`
+	Attachments []CSLAttachment `json:"attachments"`
+}
+
+// CSLName is a name of a person or organization, the latter as literal.
+type CSLName struct {
+	Family              string `json:"family"`
+	Given               string `json:"given"`
+	DroppingParticle    string `json:"dropping-particle"`
+	NonDroppingParticle string `json:"non-dropping-particle"`
+	Suffix              string `json:"suffix"`
+	Literal             string `json:"literal"`
+}
+
+// String formats the name as `<family>, <given>`, as is the convention for authors, see `Metadata`.
+func (n *CSLName) String() string {
+	if n.Literal != "" {
+		return n.Literal
+	}
+	family := strings.TrimSpace(n.NonDroppingParticle + " " + n.Family)
+	given := strings.TrimSpace(n.Given + " " + n.DroppingParticle)
+	if n.Suffix != "" {
+		given = strings.TrimSpace(given + " " + n.Suffix)
+	}
+	if given == "" {
+		return family
+	}
+	return family + ", " + given
+}
+
+// CSLDate is a date as date-parts, e.g. `[[2021, 5, 1]]`, or as text.
+type CSLDate struct {
+	DateParts [][]json.Number `json:"date-parts"`
+	Raw       string          `json:"raw"`
+	Literal   string          `json:"literal"`
+}
+
+// Year returns the year of the date, or an empty string if unknown.
+func (d *CSLDate) Year() string {
+	if len(d.DateParts) > 0 && len(d.DateParts[0]) > 0 {
+		return d.DateParts[0][0].String()
+	}
+	for _, text := range []string{d.Raw, d.Literal} {
+		if len(text) >= 4 {
+			return text[:4]
+		}
+	}
+	return ""
+}
+
+// CSLAttachment is an attached file of an item.
+type CSLAttachment struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
+}
+
+// cslText is a value that is either a string or a number, such as the item identifier.
+type cslText string
+
+func (t *cslText) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = cslText(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return errors.Context(err, "expected string or number")
+	}
+	*t = cslText(n.String())
+	return nil
+}
+
+// cslTag is a tag that is either a name or an object `{"tag": <name>}`.
+type cslTag string
+
+func (t *cslTag) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = cslTag(s)
+		return nil
+	}
+	var o struct {
+		Tag string `json:"tag"`
+	}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return errors.Context(err, "expected tag as string or object")
+	}
+	*t = cslTag(o.Tag)
+	return nil
+}
+
+// ParseCSL parses a CSL-JSON export, i.e. an array of items.
+func ParseCSL(data []byte) ([]CSLItem, error) {
+	var items []CSLItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, errors.Context(err, "failed to parse CSL-JSON")
+	}
+	return items, nil
+}
+
+// metadata returns the metadata fields of the item, by field name.
+func (item *CSLItem) metadata() map[string]string {
+	authors := make([]string, 0, len(item.Author))
+	for i := range item.Author {
+		if name := item.Author[i].String(); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	return map[string]string{
+		FieldAuthors:   strings.Join(authors, authorsSeparator+" "),
+		FieldTitle:     item.Title,
+		FieldYear:      item.Issued.Year(),
+		FieldPublisher: item.Publisher,
+		FieldDOI:       item.DOI,
+		FieldISBN:      item.ISBN,
+		FieldURL:       item.URL,
+		FieldLanguage:  item.Language,
+		FieldNotes:     item.Note,
+	}
+}
+
+// tags returns the names of the tags of the item, from both the keywords and the tags.
+func (item *CSLItem) tags() []string {
+	var tags []string
+	for _, t := range strings.Split(item.Keyword, ",") {
+		if t = strings.TrimSpace(t); t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	for _, t := range item.Tags {
+		if t := strings.TrimSpace(string(t)); t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// attachments returns the paths of the attached files, with relative paths resolved against base. Paths may
+// be given as `file://`-URL, in which case the path is decoded.
+func (item *CSLItem) attachments(base string) []string {
+	paths := strings.Split(item.File, ";")
+	for _, a := range item.Attachments {
+		paths = append(paths, a.Path)
+	}
+	var resolved []string
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); strings.HasPrefix(p, "file://") {
+			u, err := url.Parse(p)
+			if err != nil {
+				log.Warnln("Skipping attachment with invalid URL:", p, err.Error())
+				continue
+			}
+			p = filepath.FromSlash(u.Path)
+		}
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(base, p)
+		}
+		if !slices.Contains(resolved, p) {
+			resolved = append(resolved, p)
+		}
+	}
+	return resolved
+}
+
+// CSLImportOptions are the options for importing a CSL-JSON export, see `ImportCSL`.
+type CSLImportOptions struct {
+	// Base is the directory against which relative paths of attachments are resolved.
+	Base string
+	// CollectionCategory is the category in which collections are mapped onto tags, with nested collections as
+	// nested tags. Collections are not imported if empty.
+	CollectionCategory string
+	// TagCategory is the category in which tags are imported. Tags are not imported if empty.
+	TagCategory string
+	// Overwrite replaces metadata that is already present.
+	Overwrite bool
+}
+
+// ImportCSL imports the items of a CSL-JSON export. Each attachment of an item is acquired, see `Acquire`, and
+// its metadata is filled in from the item. The collections and tags of the item are mapped onto tags in the
+// categories of the options, creating tags as needed. Items are imported into objects by content, hence
+// repeated imports do not create duplicates.
+func (r *Repo) ImportCSL(items []CSLItem, opts CSLImportOptions) (ImportResult, error) {
+	if err := validateImportCategories(opts.CollectionCategory, opts.TagCategory); err != nil {
+		return ImportResult{}, err
+	}
+	var result ImportResult
+	for i := range items {
+		item := &items[i]
+		if err := r.importItem(&result, string(item.ID), item.attachments(opts.Base), item.metadata(),
+			item.classification(&opts), opts.Overwrite); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// classification returns the (category, tag)-pairs for the collections and tags of item.
+func (item *CSLItem) classification(opts *CSLImportOptions) [][2]string {
+	var tags [][2]string
+	if opts.CollectionCategory != "" {
+		for _, c := range item.Collections {
+			tags = append(tags, [2]string{opts.CollectionCategory, c})
+		}
+	}
+	if opts.TagCategory != "" {
+		for _, t := range item.tags() {
+			tags = append(tags, [2]string{opts.TagCategory, t})
+		}
+	}
+	return tags
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+const testCSL = `[
+  {
+    "id": 42,
+    "type": "article-journal",
+    "title": "On Numbers",
+    "author": [
+      {"family": "Beethoven", "given": "Ludwig", "non-dropping-particle": "van"},
+      {"family": "Doe", "given": "John", "suffix": "Jr."},
+      {"literal": "Research and Development Group"}
+    ],
+    "issued": {"date-parts": [[2021, 5, 1]]},
+    "DOI": "10.1000/182",
+    "keyword": "crypto, reading list, crypto",
+    "tags": ["go", {"tag": "crypto"}, {"tag": " rust "}],
+    "collections": ["Research/Cryptography"]
+  },
+  {
+    "id": "http://zotero.org/users/1/items/ABCD1234",
+    "type": "book",
+    "title": "On Strings",
+    "issued": {"raw": "1999-12-31"},
+    "ISBN": "978-3-16-148410-0",
+    "language": "en"
+  },
+  {
+    "id": "literal",
+    "title": "Undated",
+    "issued": {"literal": "n.d."}
+  }
+]`
+
+func TestParseCSL(t *testing.T) {
+	items, err := ParseCSL([]byte(testCSL))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(items))
+	assert.StopOnFailure(t)
+	// Identifiers are either numbers or strings.
+	assert.Equal(t, cslText("42"), items[0].ID)
+	assert.Equal(t, cslText("http://zotero.org/users/1/items/ABCD1234"), items[1].ID)
+	meta := items[0].metadata()
+	assert.Equal(t, "van Beethoven, Ludwig; Doe, John Jr.; Research and Development Group", meta[FieldAuthors])
+	assert.Equal(t, "On Numbers", meta[FieldTitle])
+	assert.Equal(t, "2021", meta[FieldYear])
+	assert.Equal(t, "10.1000/182", meta[FieldDOI])
+	// Tags are given as keywords, and as either names or objects.
+	assert.SlicesEqual(t, []string{"crypto", "reading list", "go", "rust"}, items[0].tags())
+	assert.SlicesEqual(t, []string{"Research/Cryptography"}, items[0].Collections)
+	// Dates are given as date-parts, or as text.
+	assert.Equal(t, "1999", items[1].Issued.Year())
+	assert.Equal(t, "n.d.", items[2].Issued.Year())
+	assert.Equal(t, "", (&CSLDate{}).Year())
+	assert.Equal(t, "978-3-16-148410-0", items[1].metadata()[FieldISBN])
+	assert.SlicesEqual(t, nil, items[1].tags())
+}
+
+func TestParseCSLInvalid(t *testing.T) {
+	testdata := []string{
+		`{"id": "not an array"}`,
+		`[{"id": true}]`,
+		`[{"id": "1", "tags": [42]}]`,
+		`[{"id": "1", "issued": {"date-parts": [["spring"]]}}]`,
+	}
+	for _, data := range testdata {
+		_, err := ParseCSL([]byte(data))
+		assert.NotNil(t, err)
+		assert.LogOnFailure(t, data)
+	}
+}
+
+func TestCSLClassification(t *testing.T) {
+	items, err := ParseCSL([]byte(testCSL))
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	assert.SlicesEqual(t, nil, items[0].classification(&CSLImportOptions{}))
+	assert.SlicesEqual(t, [][2]string{{"collection", "Research/Cryptography"}, {"keyword", "crypto"},
+		{"keyword", "reading list"}, {"keyword", "go"}, {"keyword", "rust"}},
+		items[0].classification(&CSLImportOptions{CollectionCategory: "collection", TagCategory: "keyword"}))
+}
+
+func TestCSLAttachments(t *testing.T) {
+	base := filepath.FromSlash("/home/user/export")
+	item := CSLItem{
+		File: "files/1/paper.pdf; /data/absolute.pdf;;file:///data/My%20Paper%231.pdf",
+		Attachments: []CSLAttachment{
+			{Path: "files/1/paper.pdf"},
+			{Path: "file:///data/caf%C3%A9.epub", Title: "Full text"},
+			{Path: "  "},
+			{Path: "file://%zz"},
+		},
+	}
+	assert.SlicesEqual(t, []string{
+		filepath.Join(base, "files", "1", "paper.pdf"),
+		filepath.FromSlash("/data/absolute.pdf"),
+		filepath.FromSlash("/data/My Paper#1.pdf"),
+		filepath.FromSlash("/data/café.epub"),
+	}, item.attachments(base))
+	assert.SlicesEqual(t, nil, (&CSLItem{}).attachments(base))
+}
+
+func TestImportCSL(t *testing.T) {
+	location := t.TempDir()
+	r, err := InitRepository(filepath.Join(location, "repo"), InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	export := filepath.Join(location, "export")
+	assert.Nil(t, os.MkdirAll(filepath.Join(export, "files"), 0o700))
+	assert.Nil(t, os.WriteFile(filepath.Join(export, "files", "numbers.pdf"), []byte("numbers"), 0o600))
+	assert.Nil(t, os.WriteFile(filepath.Join(export, "My Strings.epub"), []byte("strings"), 0o600))
+	items, err := ParseCSL([]byte(`[
+		{"id": 1, "title": "On Numbers", "issued": {"date-parts": [[2021]]}, "file": "files/numbers.pdf",
+		 "tags": [{"tag": "crypto"}], "collections": ["Research/Cryptography"]},
+		{"id": "2", "title": "On Strings", "attachments": [{"path": "file://` + filepath.ToSlash(export) + `/My%20Strings.epub"}]},
+		{"id": "3", "title": "No Files", "file": "missing.pdf"}
+	]`))
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	opts := CSLImportOptions{Base: export, CollectionCategory: "collection", TagCategory: "keyword"}
+	result, err := r.ImportCSL(items, opts)
+	assert.Nil(t, err)
+	assert.SlicesEqual(t, []string{"numbers.pdf", "My Strings.epub"}, result.Acquired)
+	assert.SlicesEqual(t, []string{"3"}, result.Skipped)
+	// Repeated imports do not create duplicates.
+	result, err = r.ImportCSL(items, opts)
+	assert.Nil(t, err)
+	assert.SlicesEqual(t, nil, result.Acquired)
+	assert.SlicesEqual(t, []string{"numbers.pdf", "My Strings.epub"}, result.Present)
+	objects, err := ExtractRepoObjectsSorted(r)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(objects))
+	assert.StopOnFailure(t)
+	assert.Equal(t, "On Strings", objects[0].Meta.Title)
+	assert.Equal(t, "On Numbers", objects[1].Meta.Title)
+	assert.Equal(t, 2021, objects[1].Meta.Year)
+	assert.True(t, objects[1].HasTag("keyword", "crypto"))
+	assert.True(t, objects[1].HasTag("collection", "research/cryptography"))
+}
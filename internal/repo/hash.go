@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cobratbq/goutils/std/builtin"
+	"github.com/cobratbq/goutils/std/builtin/maps"
+	"github.com/cobratbq/goutils/std/errors"
+	hash_ "github.com/cobratbq/goutils/std/hash"
+	io_ "github.com/cobratbq/goutils/std/io"
+	"github.com/cobratbq/goutils/std/log"
+	os_ "github.com/cobratbq/goutils/std/os"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// HashBLAKE2b is BLAKE2b with 512-bit digest, the default hash algorithm.
+	HashBLAKE2b = "blake2b"
+	// HashSHA256 is SHA-2 with 256-bit digest.
+	HashSHA256 = "sha256"
+	// HashSHA512 is SHA-2 with 512-bit digest.
+	HashSHA512 = "sha512"
+)
+
+// hashAlgorithms is the registry of hash algorithms that identify repository objects. The name of the
+// algorithm is recorded in the repository configuration and as prefix of the hashspec in properties.
+var hashAlgorithms = map[string]func() hash.Hash{
+	HashBLAKE2b: func() hash.Hash { return builtin.Expect(blake2b.New512(nil)) },
+	HashSHA256:  sha256.New,
+	HashSHA512:  sha512.New,
+}
+
+// HashAlgorithms returns the names of the supported hash algorithms, sorted.
+func HashAlgorithms() []string {
+	names := maps.ExtractKeys(hashAlgorithms)
+	slices.Sort(names)
+	return names
+}
+
+func supportedHash(algorithm string) bool {
+	_, ok := hashAlgorithms[algorithm]
+	return ok
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	if newfunc, ok := hashAlgorithms[algorithm]; ok {
+		return newfunc(), nil
+	}
+	return nil, errors.Context(errors.ErrUnsupported, "hash algorithm: "+algorithm)
+}
+
+// Hash hashes the content at location using the specified hash algorithm.
+func Hash(algorithm, location string) ([]byte, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if hash, err := hash_.HashFile(h, location); err == nil {
+		return hash, nil
+	} else {
+		return nil, errors.Context(err, "hashing content at '"+location+"'")
+	}
+}
+
+// objectHash determines the hash algorithm of an object from its properties. If the properties cannot be
+// read, the hash algorithm of the repository is assumed.
+func (r *Repo) objectHash(id string) string {
+	if obj, err := r.openObject(id); err == nil {
+		return obj.Algorithm
+	}
+	return r.config.Hash
+}
+
+// Rehash re-identifies all objects using the specified hash algorithm and selects it as hash algorithm of the
+// repository. Objects are renamed to their new checksum, properties are rewritten, and symlinks in titles and
+// tags are redirected to the new objects. Content is verified against the recorded checksum before an object
+// is renamed, and rehashing is aborted if verification fails. An interrupted rehash can be repeated, as
+// objects already identified by the specified algorithm are skipped. In case of a dry-run, changes are
+// planned but not applied.
+func (r *Repo) Rehash(algorithm string, dryRun bool) (MigrateReport, error) {
+	report := MigrateReport{DryRun: dryRun, From: r.config.Hash, To: algorithm}
+	if !supportedHash(algorithm) {
+		return report, errors.Context(errors.ErrUnsupported, "hash algorithm: "+algorithm)
+	}
+	mode := LockExclusive
+	if dryRun {
+		mode = LockShared
+	}
+	unlock, err := r.lock(mode)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+	entries, err := r.readRepoEntries()
+	if err != nil {
+		return report, err
+	}
+	m := migrator{repo: r, report: &report}
+	cache := readVerificationCache(r.location)
+	renamed := map[string]string{}
+	for _, e := range entries {
+		if !r.isObjectEntry(e) {
+			continue
+		}
+		obj, err := r.openObject(e.Name())
+		if err != nil {
+			return report, errors.Context(err, "failed to open repo-object "+e.Name()+" (use 'check' to repair)")
+		}
+		if obj.Algorithm == algorithm {
+			continue
+		}
+		oldid, path := obj.Id, r.repofilepath(obj.Id)
+		checksum, newid, err := rehashObject(path, obj.Algorithm, algorithm)
+		if err != nil {
+			return report, errors.Context(err, "failed to hash repo-object "+oldid)
+		}
+		if checksum != oldid {
+			return report, errors.Context(errors.ErrFailure, "checksum of repo-object "+oldid+
+				" does not match, possible corruption (checksum: "+checksum+")")
+		}
+		if os_.Exists(r.repofilepath(newid)) {
+			return report, errors.Context(errors.ErrIllegal, "repo-object "+oldid+" collides with existing object "+newid)
+		}
+		log.Traceln("Rehashing repo-object", oldid, "as", newid)
+		// Properties are written first, then the object is renamed. When interrupted, the repository remains
+		// consistent after a check: either the new properties or the old properties are orphaned.
+		obj.Id, obj.Algorithm = newid, algorithm
+		if err := m.writeProperties(&obj); err != nil {
+			return report, errors.Context(err, "failed to write properties for "+newid)
+		}
+		if err := m.rename(path, r.repofilepath(newid)); err != nil {
+			return report, errors.Context(err, "failed to rename repo-object "+oldid)
+		}
+		if err := m.remove(path + repoPropertiesSuffix); err != nil {
+			return report, errors.Context(err, "failed to remove previous properties of "+oldid)
+		}
+		renamed[oldid] = newid
+		if v, ok := cache[oldid]; ok {
+			delete(cache, oldid)
+			v.verified, v.ok = time.Now(), true
+			cache[newid] = v
+		}
+	}
+	if err := m.relink(r.config.Layout, renamed); err != nil {
+		return report, errors.Context(err, "failed to redirect symlinks to rehashed objects")
+	}
+	cfg := r.config
+	cfg.Hash = algorithm
+	if err := m.writeConfig(&cfg); err != nil {
+		return report, errors.Context(err, "failed to record hash algorithm in repository configuration")
+	}
+	report.Steps = append(report.Steps, "rehash "+strconv.Itoa(len(renamed))+" objects using "+algorithm)
+	if !dryRun {
+		r.config = cfg
+		if err := writeVerificationCache(r.location, cache); err != nil {
+			log.Warnln("Failed to write verification cache:", err.Error())
+		}
+		// Objects are identified by their new checksum, therefore rebuild the tag-index.
+		if err := r.reload(); err != nil {
+			log.Warnln("Failed to reload tags:", err.Error())
+		}
+	}
+	return report, nil
+}
+
+// rehashObject hashes the content at path in a single pass, using both the recorded and the new algorithm.
+func rehashObject(path, recorded, algorithm string) (string, string, error) {
+	h1, err := newHash(recorded)
+	if err != nil {
+		return "", "", err
+	}
+	h2 := builtin.Expect(newHash(algorithm))
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer io_.CloseLogged(f, "Failed to gracefully close repo-object after hashing.")
+	if _, err := io.Copy(io.MultiWriter(h1, h2), f); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(h1.Sum(nil)), hex.EncodeToString(h2.Sum(nil)), nil
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cobratbq/goutils/std/errors"
+	os_ "github.com/cobratbq/goutils/std/os"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestRehash(t *testing.T) {
+	testdata := []struct {
+		layout string
+		from   string
+		to     string
+	}{
+		{LayoutFlat, HashBLAKE2b, HashSHA256},
+		{LayoutSharded, HashBLAKE2b, HashSHA512},
+		{LayoutFlat, HashSHA256, HashBLAKE2b},
+		// rehash with the current algorithm renames nothing
+		{LayoutFlat, HashBLAKE2b, HashBLAKE2b},
+	}
+	for _, d := range testdata {
+		location := filepath.Join(t.TempDir(), "repo")
+		r, err := InitRepository(location, InitOptions{Hash: d.from, Layout: d.layout, Starters: []string{"topic/crypto"}})
+		assert.Nil(t, err)
+		obj, _, err := r.Acquire(strings.NewReader("content"), "x.pdf")
+		assert.Nil(t, err)
+		assert.Nil(t, r.Tag("topic", "crypto", &obj))
+		_, err = r.Check(CheckOptions{})
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.from, d.to)
+		checksum, err := Hash(d.to, r.repofilepath(obj.Id))
+		assert.Nil(t, err)
+		newid := hex.EncodeToString(checksum)
+		before := snapshot(t, location)
+		dryrun, err := r.Rehash(d.to, true)
+		assert.Nil(t, err)
+		assert.Equal(t, d.from, r.Config().Hash)
+		assert.Equal(t, len(before), len(snapshot(t, location)))
+		for path, entry := range snapshot(t, location) {
+			assert.Equal(t, before[path], entry)
+		}
+		report, err := r.Rehash(d.to, false)
+		assert.Nil(t, err)
+		assert.SlicesEqual(t, dryrun.Changes, report.Changes)
+		assert.Equal(t, d.to, r.Config().Hash)
+		// The object is identified by the new checksum, with its properties and symlinks.
+		rehashed, err := r.OpenObject(newid)
+		assert.Nil(t, err)
+		assert.Equal(t, d.to, rehashed.Algorithm)
+		assert.Equal(t, obj.Name, rehashed.Name)
+		assert.True(t, rehashed.HasTag("topic", "crypto"))
+		assert.Equal(t, d.from == d.to, os_.Exists(r.repofilepath(obj.Id)))
+		target, err := os.Readlink(filepath.Join(location, "topic", "crypto", obj.Name))
+		assert.Nil(t, err)
+		assert.Equal(t, r.linktarget(2, newid), target)
+		assert.SlicesEqual(t, []string{newid}, r.TaggedObjects("topic", "crypto"))
+		reopened, err := OpenRepository(location)
+		assert.Nil(t, err)
+		assert.Equal(t, d.to, reopened.Config().Hash)
+		recheck, err := reopened.Check(CheckOptions{DryRun: true, Full: true})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(recheck.Findings))
+		assert.LogOnFailure(t, d.from, d.to)
+	}
+}
+
+func TestRehashCorruption(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	r, err := InitRepository(location, InitOptions{})
+	assert.Nil(t, err)
+	obj, _, err := r.Acquire(strings.NewReader("content"), "x.pdf")
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	path := r.repofilepath(obj.Id)
+	assert.Nil(t, os.Chmod(path, 0o600))
+	assert.Nil(t, os.WriteFile(path, []byte("corrupted"), 0o400))
+	assert.StopOnFailure(t)
+	before := snapshot(t, location)
+	_, err = r.Rehash(HashSHA256, false)
+	assert.IsError(t, errors.ErrFailure, err)
+	assert.Equal(t, HashBLAKE2b, r.Config().Hash)
+	assert.Equal(t, len(before), len(snapshot(t, location)))
+	for path, entry := range snapshot(t, location) {
+		assert.Equal(t, before[path], entry)
+	}
+}
+
+func TestRehashUnsupported(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	_, err = r.Rehash("md5", false)
+	assert.IsError(t, errors.ErrUnsupported, err)
+	assert.Equal(t, HashBLAKE2b, r.Config().Hash)
+}
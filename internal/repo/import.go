@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cobratbq/goutils/std/errors"
+	io_ "github.com/cobratbq/goutils/std/io"
+	"github.com/cobratbq/goutils/std/log"
+)
+
+// Importers acquire files from other reference managers, together with their metadata and classification.
+// Objects are identified by content, hence repeated imports do not create duplicates: metadata is filled in and
+// tags are added to the existing objects.
+
+// ImportResult is the result of an import.
+type ImportResult struct {
+	// Acquired contains the names of the newly acquired files.
+	Acquired []string
+	// Present contains the names of the files of which the content was already present.
+	Present []string
+	// Failed contains the paths of the files that failed to import.
+	Failed []string
+	// Skipped contains the identifiers of the imported items without (accessible) files.
+	Skipped []string
+}
+
+// validateImportCategories checks the categories for imported tags. Empty categories are acceptable, as these
+// disable the corresponding import.
+func validateImportCategories(cats ...string) error {
+	for _, cat := range cats {
+		if cat != "" && !validCategoryName(sanitizeName(cat)) {
+			return errors.Context(errors.ErrIllegal, "invalid category: "+cat)
+		}
+	}
+	return nil
+}
+
+// importItem imports the files at paths, see `importFile`, as the files of the item identified by id, and
+// records the outcome in result. Paths that are not accessible files are skipped, with a warning. Failures are
+// recorded, only failure to acquire the lock is returned.
+func (r *Repo) importItem(result *ImportResult, id string, paths []string, meta map[string]string, tags [][2]string, overwrite bool) error {
+	var imported bool
+	for _, path := range paths {
+		if !isRegularFile(path) {
+			log.Warnln("Skipping file of item", id+": not an accessible file:", path)
+			continue
+		}
+		imported = true
+		obj, present, err := r.importFile(path, meta, tags, "item "+id, overwrite)
+		if errors.Is(err, ErrLocked) {
+			return err
+		} else if err != nil {
+			log.Warnln("Failed to import file of item", id+":", path, err.Error())
+			result.Failed = append(result.Failed, path)
+		} else if present {
+			result.Present = append(result.Present, obj.Name)
+		} else {
+			result.Acquired = append(result.Acquired, obj.Name)
+		}
+	}
+	if !imported {
+		result.Skipped = append(result.Skipped, id)
+	}
+	return nil
+}
+
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// importFile acquires the file at path, then fills in its metadata, see `Metadata.fill`, and tags it with the
+// (category, tag)-pairs of tags, creating tags as needed. Invalid tags are skipped, with a warning. The
+// returned boolean indicates that the content was already present.
+func (r *Repo) importFile(path string, meta map[string]string, tags [][2]string, source string, overwrite bool) (RepoObj, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return RepoObj{}, false, err
+	}
+	defer io_.CloseLogged(f, "Failed to gracefully close imported file")
+	obj, present, err := r.Acquire(f, filepath.Base(path))
+	if err != nil {
+		return RepoObj{}, false, err
+	}
+	if obj.Meta.fill(meta, source, overwrite) {
+		if err := r.Save(obj); err != nil {
+			return obj, present, errors.Context(err, "failed to save metadata")
+		}
+	}
+	for _, t := range tags {
+		cat, components := t[0], strings.Split(t[1], tagSeparator)
+		for i := range components {
+			components[i] = strings.TrimSpace(components[i])
+		}
+		tag := strings.Trim(strings.Join(components, tagSeparator), tagSeparator)
+		if !validTagPath(sanitizeTagPath(tag)) {
+			log.Warnln("Skipping invalid tag of", source+":", cat+tagSeparator+tag)
+			continue
+		}
+		if err := r.ensureTag(cat, tag); err != nil {
+			return obj, present, errors.Context(err, "failed to create tag "+cat+tagSeparator+tag)
+		}
+		if err := r.Tag(cat, tag, &obj); err != nil {
+			return obj, present, errors.Context(err, "failed to tag with "+cat+tagSeparator+tag)
+		}
+	}
+	return obj, present, nil
+}
+
+// ensureTag creates tag in category cat, unless it exists.
+func (r *Repo) ensureTag(cat, tag string) error {
+	key := sanitizeTagPath(tag)
+	if slices.ContainsFunc(r.Tags(cat), func(t Tag) bool { return t.Key == key }) {
+		return nil
+	}
+	return r.CreateTag(cat, tag)
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/cobratbq/goutils/std/builtin/maps"
+	"github.com/cobratbq/goutils/std/log"
+)
+
+// tagRef refers to a tag within a category, by key.
+type tagRef struct {
+	cat string
+	tag string
+}
+
+// tagIndex is the in-memory index of the tag-symlinks: the tags of each object and the objects with each tag.
+// The index answers membership questions without accessing the file system. It is built upon (re)loading the
+// repository, and maintained by tagging and untagging.
+type tagIndex struct {
+	// objects maps the identifier of an object to its tags, per category.
+	objects map[string]map[string][]string
+	// tags maps each tag to the identifiers of the objects with the tag.
+	tags map[tagRef]map[string]struct{}
+}
+
+// buildTagIndex builds the index from the tag-symlinks in the tag-directories of the categories.
+func buildTagIndex(location string, cats map[string]category) *tagIndex {
+	index := tagIndex{objects: map[string]map[string][]string{}, tags: map[tagRef]map[string]struct{}{}}
+	for key, c := range cats {
+		for _, t := range c.tags {
+			dir := filepath.Join(location, c.dir, t.Path)
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				log.Warnln("Failed to index tag-directory:", dir, err.Error())
+				continue
+			}
+			for _, e := range entries {
+				if e.Type()&os.ModeSymlink == 0 {
+					continue
+				}
+				target, err := os.Readlink(filepath.Join(dir, e.Name()))
+				if err != nil {
+					continue
+				}
+				index.add(key, t.Key, filepath.Base(target))
+			}
+		}
+	}
+	return &index
+}
+
+func (i *tagIndex) add(cat, tag, id string) {
+	ref := tagRef{cat: cat, tag: tag}
+	if i.tags[ref] == nil {
+		i.tags[ref] = map[string]struct{}{}
+	}
+	i.tags[ref][id] = struct{}{}
+	if i.objects[id] == nil {
+		i.objects[id] = map[string][]string{}
+	}
+	if !slices.Contains(i.objects[id][cat], tag) {
+		i.objects[id][cat] = append(i.objects[id][cat], tag)
+		slices.Sort(i.objects[id][cat])
+	}
+}
+
+func (i *tagIndex) remove(cat, tag, id string) {
+	ref := tagRef{cat: cat, tag: tag}
+	delete(i.tags[ref], id)
+	if len(i.tags[ref]) == 0 {
+		delete(i.tags, ref)
+	}
+	if idx := slices.Index(i.objects[id][cat], tag); idx >= 0 {
+		i.objects[id][cat] = slices.Delete(i.objects[id][cat], idx, idx+1)
+	}
+	if len(i.objects[id][cat]) == 0 {
+		delete(i.objects[id], cat)
+	}
+	if len(i.objects[id]) == 0 {
+		delete(i.objects, id)
+	}
+}
+
+// ObjectTags returns the tags of obj per category, according to the tag-symlinks. The result is answered from
+// the in-memory index, see `Reload`.
+func (r *Repo) ObjectTags(obj *RepoObj) map[string][]string {
+	r.idxmu.RLock()
+	defer r.idxmu.RUnlock()
+	tags := make(map[string][]string, len(r.index.objects[obj.Id]))
+	for cat, t := range r.index.objects[obj.Id] {
+		tags[cat] = slices.Clone(t)
+	}
+	return tags
+}
+
+// TaggedObjects returns the (sorted) identifiers of the objects with tag in category cat, according to the
+// tag-symlinks. The result is answered from the in-memory index, see `Reload`.
+func (r *Repo) TaggedObjects(cat, tag string) []string {
+	r.idxmu.RLock()
+	defer r.idxmu.RUnlock()
+	ids := maps.ExtractKeys(r.index.tags[tagRef{cat: sanitizeName(cat), tag: sanitizeTagPath(tag)}])
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+//go:build !unix
+
+package repo
+
+import "os"
+
+// inode is not supported on this platform. Returns 0.
+func inode(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,18 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+//go:build unix
+
+package repo
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns the inode number of the file, or 0 if not available.
+func inode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cobratbq/goutils/std/builtin/maps"
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+	os_ "github.com/cobratbq/goutils/std/os"
+)
+
+const (
+	// LayoutFlat stores all objects and properties directly in the object-repository directory.
+	LayoutFlat = "flat"
+	// LayoutSharded stores objects and properties in two levels of shard-directories, named after the first
+	// characters of the checksum, e.g. `repo/ab/cd/abcd…`. This keeps directories small for large
+	// repositories.
+	LayoutSharded = "sharded"
+	// shardWidth is the number of characters of the checksum that name a shard-directory.
+	shardWidth = 2
+	// shardDepth is the number of levels of shard-directories.
+	shardDepth = 2
+)
+
+// Layouts returns the names of the supported object layouts.
+func Layouts() []string {
+	return []string{LayoutFlat, LayoutSharded}
+}
+
+func supportedLayout(layout string) bool {
+	return layout == LayoutFlat || layout == LayoutSharded
+}
+
+// shardpath returns the path of name relative to the object-repository directory, according to layout.
+func shardpath(layout, name string) string {
+	if layout != LayoutSharded || len(name) < shardWidth*shardDepth {
+		return name
+	}
+	parts := make([]string, 0, shardDepth+1)
+	for i := range shardDepth {
+		parts = append(parts, name[i*shardWidth:(i+1)*shardWidth])
+	}
+	return filepath.Join(append(parts, name)...)
+}
+
+// isShardDir checks if name is (supposedly) the name of a shard-directory.
+func isShardDir(name string) bool {
+	if len(name) != shardWidth {
+		return false
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// linktarget returns the relative symlink target for object id, for a symlink in a directory at the
+// specified depth below the repository root, e.g. 1 for titles and 2 for tags.
+func linktarget(layout string, depth int, id string) string {
+	parts := make([]string, 0, depth+2)
+	for range depth {
+		parts = append(parts, "..")
+	}
+	return filepath.Join(append(parts, subdirRepo, shardpath(layout, id))...)
+}
+
+func (r *Repo) linktarget(depth int, id string) string {
+	return linktarget(r.config.Layout, depth, id)
+}
+
+// repoEntry is an entry of the object-repository, together with its path.
+type repoEntry struct {
+	os.DirEntry
+	path string
+}
+
+// readRepoEntries lists the entries of the object-repository, including the entries in shard-directories.
+// Entries are listed regardless of the layout, such that misplaced entries can be detected, see `placed`.
+func (r *Repo) readRepoEntries() ([]repoEntry, error) {
+	var result []repoEntry
+	var walk func(dir string, depth int) error
+	walk = func(dir string, depth int) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			path := filepath.Join(dir, e.Name())
+			if depth < shardDepth && e.IsDir() && isShardDir(e.Name()) {
+				if err := walk(path, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			result = append(result, repoEntry{DirEntry: e, path: path})
+		}
+		return nil
+	}
+	if err := walk(r.repofilepath(""), 0); err != nil {
+		return nil, errors.Context(err, "failed to open object-repository directory")
+	}
+	return result, nil
+}
+
+// placed checks if the entry is at the location prescribed by the layout of the repository.
+func (r *Repo) placed(e repoEntry) bool {
+	return e.path == r.repofilepath(e.Name())
+}
+
+// isObjectEntry checks if an entry is (supposedly) a repository object at its proper location.
+func (r *Repo) isObjectEntry(e repoEntry) bool {
+	return isObjectEntry(e) && r.placed(e)
+}
+
+// Relayout converts the object-repository to the specified layout, in place. Objects and properties are moved
+// to the location prescribed by the layout, and symlinks in titles and tags are redirected. Misplaced entries
+// are moved as well, therefore relayout with the current layout repairs misplaced objects. An interrupted
+// relayout can be repeated. In case of a dry-run, changes are planned but not applied.
+func (r *Repo) Relayout(layout string, dryRun bool) (MigrateReport, error) {
+	report := MigrateReport{DryRun: dryRun, From: r.config.Layout, To: layout}
+	if !supportedLayout(layout) {
+		return report, errors.Context(errors.ErrUnsupported, "layout: "+layout)
+	}
+	mode := LockExclusive
+	if dryRun {
+		mode = LockShared
+	}
+	unlock, err := r.lock(mode)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+	entries, err := r.readRepoEntries()
+	if err != nil {
+		return report, err
+	}
+	m := migrator{repo: r, report: &report}
+	objects := map[string]string{}
+	var moved int
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") || strings.HasPrefix(e.Name(), tempFilePrefix) {
+			continue
+		}
+		if !strings.HasSuffix(e.Name(), repoPropertiesSuffix) {
+			objects[e.Name()] = e.Name()
+		}
+		dest := filepath.Join(r.repofilepath(""), shardpath(layout, e.Name()))
+		if dest == e.path {
+			continue
+		}
+		if os_.Exists(dest) {
+			return report, errors.Context(errors.ErrIllegal, "cannot move "+e.path+": destination exists: "+dest)
+		}
+		if err := m.rename(e.path, dest); err != nil {
+			return report, errors.Context(err, "failed to move "+e.path)
+		}
+		if !strings.HasSuffix(e.Name(), repoPropertiesSuffix) {
+			moved++
+		}
+	}
+	if err := m.relink(layout, objects); err != nil {
+		return report, errors.Context(err, "failed to redirect symlinks to moved objects")
+	}
+	cfg := r.config
+	cfg.Layout = layout
+	if err := m.writeConfig(&cfg); err != nil {
+		return report, errors.Context(err, "failed to record layout in repository configuration")
+	}
+	report.Steps = append(report.Steps, "move "+strconv.Itoa(moved)+" objects into "+layout+" layout")
+	if !dryRun {
+		r.config = cfg
+		pruneShardDirs(r.repofilepath(""), 0)
+	}
+	return report, nil
+}
+
+// pruneShardDirs removes empty shard-directories, e.g. after conversion to the flat layout.
+func pruneShardDirs(dir string, depth int) {
+	if depth >= shardDepth {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !isShardDir(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		pruneShardDirs(path, depth+1)
+		if err := os.Remove(path); err == nil {
+			log.Traceln("Removed empty shard-directory:", path)
+		}
+	}
+}
+
+// relink redirects symlinks in titles and tags to the objects' locations according to layout. Objects are
+// specified as mapping from the current identifier to the (possibly new) identifier. Symlinks to objects
+// that are not specified are left untouched.
+func (m *migrator) relink(layout string, objects map[string]string) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	index, err := readTagEntries(m.repo.location)
+	if err != nil {
+		return err
+	}
+	type linkdir struct {
+		path  string
+		depth int
+	}
+	dirs := []linkdir{{path: filepath.Join(m.repo.location, subdirTitles), depth: 1}}
+	cats := maps.ExtractKeys(index)
+	slices.Sort(cats)
+	for _, cat := range cats {
+		for _, tag := range index[cat].tags {
+			dirs = append(dirs, linkdir{path: filepath.Join(m.repo.location, index[cat].dir, tag.Path), depth: tagdepth(tag.Key)})
+		}
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir.path)
+		if err != nil {
+			return errors.Context(err, "failed to open directory "+dir.path)
+		}
+		for _, e := range entries {
+			if e.Type()&os.ModeSymlink == 0 {
+				continue
+			}
+			path := filepath.Join(dir.path, e.Name())
+			target, err := os.Readlink(path)
+			if err != nil {
+				return errors.Context(err, "failed to query symlink "+path)
+			}
+			newid, ok := objects[filepath.Base(target)]
+			if !ok {
+				continue
+			}
+			expected := linktarget(layout, dir.depth, newid)
+			if target == expected {
+				continue
+			}
+			if err := m.remove(path); err != nil {
+				return err
+			}
+			if err := m.symlink(expected, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
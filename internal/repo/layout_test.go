@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cobratbq/goutils/std/errors"
+	os_ "github.com/cobratbq/goutils/std/os"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestShardpath(t *testing.T) {
+	testdata := []struct {
+		layout   string
+		name     string
+		expected string
+	}{
+		{LayoutFlat, "abcdef", "abcdef"},
+		{LayoutFlat, "abcdef.properties", "abcdef.properties"},
+		{LayoutSharded, "abcdef", filepath.Join("ab", "cd", "abcdef")},
+		{LayoutSharded, "abcdef.properties", filepath.Join("ab", "cd", "abcdef.properties")},
+		{LayoutSharded, "abc", "abc"},
+		{LayoutSharded, "", ""},
+	}
+	for _, d := range testdata {
+		assert.Equal(t, d.expected, shardpath(d.layout, d.name))
+		assert.LogOnFailure(t, d.layout, d.name)
+	}
+}
+
+func TestRelayout(t *testing.T) {
+	testdata := []struct {
+		from string
+		to   string
+	}{
+		{LayoutFlat, LayoutSharded},
+		{LayoutSharded, LayoutFlat},
+		// relayout with the current layout moves nothing
+		{LayoutFlat, LayoutFlat},
+		{LayoutSharded, LayoutSharded},
+	}
+	for _, d := range testdata {
+		location := filepath.Join(t.TempDir(), "repo")
+		r, err := InitRepository(location, InitOptions{Layout: d.from, Starters: []string{"topic/programming/go"}})
+		assert.Nil(t, err)
+		a, _, err := r.Acquire(strings.NewReader("a"), "a.pdf")
+		assert.Nil(t, err)
+		b, _, err := r.Acquire(strings.NewReader("b"), "b.pdf")
+		assert.Nil(t, err)
+		assert.Nil(t, r.Tag("topic", "programming/go", &a))
+		_, err = r.Check(CheckOptions{})
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.from, d.to)
+		before := snapshot(t, location)
+		dryrun, err := r.Relayout(d.to, true)
+		assert.Nil(t, err)
+		assert.Equal(t, d.from, r.Config().Layout)
+		assert.Equal(t, len(before), len(snapshot(t, location)))
+		for path, entry := range snapshot(t, location) {
+			assert.Equal(t, before[path], entry)
+		}
+		report, err := r.Relayout(d.to, false)
+		assert.Nil(t, err)
+		assert.SlicesEqual(t, dryrun.Changes, report.Changes)
+		assert.Equal(t, d.to, r.Config().Layout)
+		if d.from == d.to {
+			// Only the configuration is rewritten.
+			assert.SlicesEqual(t, []Change{{Op: ChangeWriteProperties, Path: configpath(location)}}, report.Changes)
+		}
+		// The layout is recorded, objects are in place and symlinks are redirected.
+		reopened, err := OpenRepository(location)
+		assert.Nil(t, err)
+		assert.Equal(t, d.to, reopened.Config().Layout)
+		for _, obj := range []RepoObj{a, b} {
+			assert.True(t, os_.ExistsFile(filepath.Join(location, subdirRepo, shardpath(d.to, obj.Id))))
+			assert.True(t, os_.ExistsFile(filepath.Join(location, subdirRepo, shardpath(d.to, obj.Id+repoPropertiesSuffix))))
+			target, err := os.Readlink(filepath.Join(location, subdirTitles, obj.Name))
+			assert.Nil(t, err)
+			assert.Equal(t, linktarget(d.to, 1, obj.Id), target)
+			assert.True(t, os_.ExistsFile(filepath.Join(location, subdirTitles, obj.Name)))
+		}
+		target, err := os.Readlink(filepath.Join(location, "topic", "programming", "go", a.Name))
+		assert.Nil(t, err)
+		assert.Equal(t, linktarget(d.to, 3, a.Id), target)
+		recheck, err := reopened.Check(CheckOptions{DryRun: true})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(recheck.Findings))
+		assert.LogOnFailure(t, d.from, d.to)
+	}
+}
+
+func TestRelayoutUnsupported(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	_, err = r.Relayout("nested", false)
+	assert.IsError(t, errors.ErrUnsupported, err)
+	assert.Equal(t, LayoutFlat, r.Config().Layout)
+}
+
+func TestCheckMisplacedObject(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	r, err := InitRepository(location, InitOptions{Layout: LayoutSharded})
+	assert.Nil(t, err)
+	obj, _, err := r.Acquire(strings.NewReader("x"), "x.pdf")
+	assert.Nil(t, err)
+	_, err = r.Check(CheckOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	// Move object and properties to the location of the flat layout, e.g. as by an interrupted relayout.
+	for _, name := range []string{obj.Id, obj.Id + repoPropertiesSuffix} {
+		assert.Nil(t, os.Rename(r.repofilepath(name), filepath.Join(location, subdirRepo, name)))
+	}
+	assert.StopOnFailure(t)
+	report, err := r.Check(CheckOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, countFindings(&report, KindMisplacedObject, false))
+	assert.Equal(t, 0, countFindings(&report, KindOrphanedProperties, true))
+	// Relayout with the current layout moves misplaced objects into place.
+	_, err = r.Relayout(LayoutSharded, false)
+	assert.Nil(t, err)
+	assert.True(t, os_.ExistsFile(r.repofilepath(obj.Id)))
+	report, err = r.Check(CheckOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(report.Findings))
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cobratbq/goutils/std/errors"
+	io_ "github.com/cobratbq/goutils/std/io"
+	"github.com/cobratbq/goutils/std/log"
+)
+
+// lockFilename is the name of the (advisory) lock-file in the repository root.
+const lockFilename = ".doclib.lock"
+
+// lockRetryInterval is the interval between attempts to acquire the lock while waiting.
+const lockRetryInterval = 100 * time.Millisecond
+
+// ErrLocked indicates that the repository lock could not be acquired.
+var ErrLocked = errors.NewStringError("repository is locked")
+
+// ErrLockTimeout indicates that the repository lock did not become available within the lock timeout, see
+// `SetLockTimeout`. It is an `ErrLocked`.
+var ErrLockTimeout = errors.Context(ErrLocked, "lock not available within timeout")
+
+// LockMode is the mode of the repository lock.
+type LockMode uint8
+
+const (
+	// LockShared is for operations that read from the repository or modify a single object's properties.
+	// Any number of shared locks can be held simultaneously.
+	LockShared LockMode = iota
+	// LockExclusive is for operations that add, remove or restructure repository content, such as `Check`,
+	// `Acquire` and `Delete`.
+	LockExclusive
+)
+
+func (m LockMode) String() string {
+	if m == LockExclusive {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+// SetLockTimeout sets the duration to wait for the repository lock to become available. With a timeout of
+// zero, operations fail immediately with `ErrLockTimeout` if the lock is not available. The timeout applies to
+// the lock within the process as well as to the lock among processes.
+func (r *Repo) SetLockTimeout(timeout time.Duration) {
+	r.lockTimeout.Store(int64(timeout))
+}
+
+// lockDeadline returns the time until which to wait for the repository lock.
+func (r *Repo) lockDeadline() time.Time {
+	return time.Now().Add(time.Duration(r.lockTimeout.Load()))
+}
+
+// lock acquires the repository lock in the specified mode. The lock is held until the returned function is
+// called. Within the process, operations are coordinated through a read-write mutex, such that shared
+// operations proceed concurrently and exclusive operations proceed alone. Among processes, i.e. instances of
+// doclib and doccli, operations are coordinated through an advisory file-lock, which the process holds for as
+// long as any of its operations holds the lock. Both are awaited for at most the lock timeout, after which
+// `ErrLockTimeout` is returned.
+func (r *Repo) lock(mode LockMode) (func(), error) {
+	deadline := r.lockDeadline()
+	unlock, err := r.lockProcess(mode, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.acquireFileLock(mode, deadline); err != nil {
+		unlock()
+		return nil, err
+	}
+	return func() {
+		r.releaseFileLock()
+		unlock()
+	}, nil
+}
+
+// lockProcess acquires the in-process mutex in the specified mode, retrying until the deadline. The mutex is
+// held until the returned function is called.
+func (r *Repo) lockProcess(mode LockMode, deadline time.Time) (func(), error) {
+	trylock, unlock := r.mu.TryRLock, r.mu.RUnlock
+	if mode == LockExclusive {
+		trylock, unlock = r.mu.TryLock, r.mu.Unlock
+	}
+	for !trylock() {
+		if time.Now().After(deadline) {
+			return nil, errors.Context(ErrLockTimeout, "repository is in use within process, "+mode.String()+
+				" lock not available")
+		}
+		time.Sleep(lockRetryInterval)
+	}
+	return unlock, nil
+}
+
+// acquireFileLock acquires the advisory file-lock, or increments the count if the process already holds it,
+// retrying until the deadline.
+//
+// The holder of an exclusive lock writes its details into the lock-file, and clears them upon release. If
+// details are present when the exclusive lock is acquired, the previous holder terminated without releasing
+// the lock. As the lock itself is released by the operating system when a process terminates, such a stale
+// lock is reported and taken over.
+func (r *Repo) acquireFileLock(mode LockMode, deadline time.Time) error {
+	r.lockmu.Lock()
+	defer r.lockmu.Unlock()
+	if r.lockCount > 0 {
+		// The in-process mutex guarantees that an exclusive lock is never held concurrently with other locks,
+		// therefore the file-lock that is already held is a shared lock.
+		r.lockCount++
+		return nil
+	}
+	lockf, err := os.OpenFile(filepath.Join(r.location, lockFilename), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return errors.Context(err, "failed to open repository lock-file")
+	}
+	for {
+		locked, err := flock(lockf, mode)
+		if err != nil {
+			io_.CloseLogged(lockf, "Failed to gracefully close repository lock-file.")
+			return errors.Context(err, "failed to acquire repository lock")
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			holder := readLockHolder(lockf)
+			io_.CloseLogged(lockf, "Failed to gracefully close repository lock-file.")
+			if holder == "" {
+				return errors.Context(ErrLockTimeout, "repository is in use, "+mode.String()+" lock not available")
+			}
+			return errors.Context(ErrLockTimeout, "exclusively held by "+holder)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+	if mode == LockExclusive {
+		if holder := readLockHolder(lockf); holder != "" {
+			log.Warnln("Taking over stale repository lock, previously held by", holder)
+		}
+		if err := writeLockHolder(lockf); err != nil {
+			log.Warnln("Failed to write details into repository lock-file:", err.Error())
+		}
+	}
+	r.lockf, r.lockMode, r.lockCount = lockf, mode, 1
+	log.Traceln("Acquired repository lock:", mode.String())
+	return nil
+}
+
+// releaseFileLock decrements the count and releases the advisory file-lock when no longer in use.
+func (r *Repo) releaseFileLock() {
+	r.lockmu.Lock()
+	defer r.lockmu.Unlock()
+	if r.lockCount--; r.lockCount > 0 {
+		return
+	}
+	if r.lockMode == LockExclusive {
+		if err := r.lockf.Truncate(0); err != nil {
+			log.Warnln("Failed to clear details from repository lock-file:", err.Error())
+		}
+	}
+	// Closing the lock-file releases the lock.
+	io_.CloseLogged(r.lockf, "Failed to gracefully close repository lock-file.")
+	r.lockf = nil
+	log.Traceln("Released repository lock:", r.lockMode.String())
+}
+
+func readLockHolder(lockf *os.File) string {
+	data, err := io.ReadAll(io.NewSectionReader(lockf, 0, 4096))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func writeLockHolder(lockf *os.File) error {
+	hostname, _ := os.Hostname()
+	holder := "pid " + strconv.Itoa(os.Getpid()) + " (" + filepath.Base(os.Args[0]) + ") on host '" + hostname +
+		"' since " + time.Now().Format(time.RFC3339) + "\n"
+	if err := lockf.Truncate(0); err != nil {
+		return err
+	}
+	_, err := lockf.WriteAt([]byte(holder), 0)
+	return err
+}
@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+//go:build !unix
+
+package repo
+
+import (
+	"os"
+
+	"github.com/cobratbq/goutils/std/log"
+)
+
+// flock is not supported on this platform. The lock is always acquired.
+func flock(_ *os.File, mode LockMode) (bool, error) {
+	log.Traceln("Repository locking is not supported on this platform. Proceeding without lock:", mode.String())
+	return true, nil
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestLockTimeout(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	r.SetLockTimeout(200 * time.Millisecond)
+	testdata := []struct {
+		held      LockMode
+		requested LockMode
+		available bool
+	}{
+		{LockShared, LockShared, true},
+		{LockShared, LockExclusive, false},
+		{LockExclusive, LockShared, false},
+		{LockExclusive, LockExclusive, false},
+	}
+	for _, d := range testdata {
+		unlock, err := r.lock(d.held)
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.held.String())
+		start := time.Now()
+		unlock2, err := r.lock(d.requested)
+		if d.available {
+			assert.Nil(t, err)
+			unlock2()
+		} else {
+			// The in-process lock is awaited for at most the lock timeout.
+			assert.IsError(t, ErrLockTimeout, err)
+			assert.IsError(t, ErrLocked, err)
+			assert.True(t, time.Since(start) < 2*time.Second)
+		}
+		unlock()
+		assert.LogOnFailure(t, d.held.String(), d.requested.String())
+	}
+	// Reload, as other exclusive operations, is not blocked indefinitely.
+	unlock, err := r.lock(LockShared)
+	assert.Nil(t, err)
+	assert.IsError(t, ErrLockTimeout, r.Reload())
+	unlock()
+	assert.Nil(t, r.Reload())
+}
+
+func TestFileLock(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	_, err := InitRepository(location, InitOptions{})
+	assert.Nil(t, err)
+	// Separate instances of the repository coordinate through the file-lock only, as separate processes do.
+	r1, err := OpenRepository(location)
+	assert.Nil(t, err)
+	r2, err := OpenRepository(location)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	r2.SetLockTimeout(0)
+	testdata := []struct {
+		held      LockMode
+		requested LockMode
+		available bool
+	}{
+		{LockShared, LockShared, true},
+		{LockShared, LockExclusive, false},
+		{LockExclusive, LockShared, false},
+		{LockExclusive, LockExclusive, false},
+	}
+	for _, d := range testdata {
+		unlock, err := r1.lock(d.held)
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.held.String())
+		unlock2, err := r2.lock(d.requested)
+		if d.available {
+			assert.Nil(t, err)
+			unlock2()
+		} else {
+			assert.IsError(t, ErrLockTimeout, err)
+			// The holder of an exclusive lock is identified.
+			assert.Equal(t, d.held == LockExclusive, strings.Contains(err.Error(), "exclusively held by pid "+strconv.Itoa(os.Getpid())))
+		}
+		unlock()
+		// The lock is available once released.
+		unlock2, err = r2.lock(d.requested)
+		assert.Nil(t, err)
+		unlock2()
+		assert.LogOnFailure(t, d.held.String(), d.requested.String())
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	r, err := InitRepository(location, InitOptions{})
+	assert.Nil(t, err)
+	// Details in the lock-file without a lock being held remain from a process that terminated.
+	assert.Nil(t, os.WriteFile(filepath.Join(location, lockFilename), []byte("pid 1 (doccli) on host 'other'\n"), 0o600))
+	assert.StopOnFailure(t)
+	r.SetLockTimeout(0)
+	unlock, err := r.lock(LockExclusive)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	data, err := os.ReadFile(filepath.Join(location, lockFilename))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "pid "+strconv.Itoa(os.Getpid())+" "))
+	unlock()
+	// Details are cleared upon release.
+	data, err = os.ReadFile(filepath.Join(location, lockFilename))
+	assert.Nil(t, err)
+	assert.Equal(t, "", string(data))
+}
+
+func TestNestedSharedLock(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	r, err := InitRepository(location, InitOptions{})
+	assert.Nil(t, err)
+	other, err := OpenRepository(location)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	other.SetLockTimeout(0)
+	// The file-lock is held for as long as any operation of the process holds the lock.
+	unlock1, err := r.lock(LockShared)
+	assert.Nil(t, err)
+	unlock2, err := r.lock(LockShared)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	unlock1()
+	_, err = other.lock(LockExclusive)
+	assert.IsError(t, ErrLockTimeout, err)
+	unlock2()
+	unlock, err := other.lock(LockExclusive)
+	assert.Nil(t, err)
+	unlock()
+}
@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+//go:build unix
+
+package repo
+
+import (
+	"os"
+	"syscall"
+)
+
+// flock attempts to acquire the lock on lockf without blocking. Returns false if the lock is held elsewhere.
+func flock(lockf *os.File, mode LockMode) (bool, error) {
+	how := syscall.LOCK_SH
+	if mode == LockExclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(lockf.Fd()), how|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
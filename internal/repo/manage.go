@@ -0,0 +1,421 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cobratbq/goutils/std/errors"
+)
+
+// Management of categories and tags restructures the repository, therefore requires the exclusive lock. All
+// objects are opened first, such that an operation is refused if any object cannot be updated. Then the file
+// system is changed, after which the properties of affected objects are updated. If interrupted, a check
+// restores consistency between symlinks and properties. Categories and tags are resolved by key, see
+// `sanitizeName`. New directories are named as specified, such that capitalization and formatting can be
+// chosen freely.
+
+// hasCategory checks if category cat exists. The caller is expected to hold the mutex.
+func (r *Repo) hasCategory(cat string) bool {
+	_, ok := r.cats[sanitizeName(cat)]
+	return ok
+}
+
+// hasTag checks if tag exists in category cat. The caller is expected to hold the mutex.
+func (r *Repo) hasTag(cat, tag string) bool {
+	_, ok := r.cats[sanitizeName(cat)].paths[sanitizeTagPath(tag)]
+	return ok
+}
+
+// CreateCategory creates a new category.
+func (r *Repo) CreateCategory(cat string) error {
+	if !validCategoryName(cat) {
+		return errors.Context(errors.ErrIllegal, "invalid category: "+cat)
+	}
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if r.hasCategory(cat) {
+		return errors.Context(errors.ErrIllegal, "category already exists: "+cat)
+	}
+	if err := os.Mkdir(filepath.Join(r.location, cat), 0o700); err != nil {
+		return errors.Context(err, "failed to create category directory")
+	}
+	return r.reload()
+}
+
+// CreateTag creates a new (possibly nested) tag in category cat. The category and the ancestors of the tag are
+// created as needed.
+func (r *Repo) CreateTag(cat, tag string) error {
+	if !validCategoryName(cat) || !validTagPath(tag) {
+		return errors.Context(errors.ErrIllegal, "invalid category or tag: "+cat+tagSeparator+tag)
+	}
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if r.hasTag(cat, tag) {
+		return errors.Context(errors.ErrIllegal, "tag already exists: "+cat+tagSeparator+tag)
+	}
+	if err := os.MkdirAll(filepath.Join(r.location, r.tagdir(cat, tag)), 0o700); err != nil {
+		return errors.Context(err, "failed to create tag directory")
+	}
+	return r.reload()
+}
+
+// RenameCategory renames category cat to newcat, and updates the properties of tagged objects. If both names
+// resolve to the same key, only the directory is renamed.
+func (r *Repo) RenameCategory(cat, newcat string) error {
+	if !validCategoryName(cat) || !validCategoryName(newcat) {
+		return errors.Context(errors.ErrIllegal, "invalid category: "+cat+", "+newcat)
+	}
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	key, newkey := sanitizeName(cat), sanitizeName(newcat)
+	if !r.hasCategory(cat) {
+		return errors.Context(errors.ErrIllegal, "category does not exist: "+cat)
+	}
+	if newkey != key && r.hasCategory(newcat) {
+		return errors.Context(errors.ErrIllegal, "category already exists: "+newcat)
+	}
+	// Objects are opened before making changes, such that no object is left inconsistent with the tags.
+	objects, err := r.openObjects()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(r.location, r.tagdir(cat, "")), filepath.Join(r.location, newcat)); err != nil {
+		return errors.Context(err, "failed to rename category directory")
+	}
+	if newkey != key {
+		if err := r.updateObjects(objects, func(obj *RepoObj) bool {
+			if len(obj.Tags[key]) == 0 {
+				return false
+			}
+			obj.Tags[newkey] = obj.Tags[key]
+			delete(obj.Tags, key)
+			return true
+		}); err != nil {
+			return err
+		}
+	}
+	return r.reload()
+}
+
+// RenameTag renames tag in category cat to newtag, including its nested tags. The tag can be moved within the
+// hierarchy of the category, e.g. from `go` to `programming/go`. Symlinks are redirected as needed and the
+// properties of tagged objects are updated. If both tags resolve to the same key, only the directory is
+// renamed.
+func (r *Repo) RenameTag(cat, tag, newtag string) error {
+	if !validCategoryName(cat) || !validTagPath(tag) || !validTagPath(newtag) {
+		return errors.Context(errors.ErrIllegal, "invalid category or tag")
+	}
+	catkey, key, newkey := sanitizeName(cat), sanitizeTagPath(tag), sanitizeTagPath(newtag)
+	if strings.HasPrefix(newkey, key+tagSeparator) {
+		return errors.Context(errors.ErrIllegal, "cannot rename tag '"+tag+"' to its nested tag '"+newtag+"'")
+	}
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !r.hasTag(cat, tag) {
+		return errors.Context(errors.ErrIllegal, "tag does not exist: "+cat+tagSeparator+tag)
+	}
+	if newkey != key && r.hasTag(cat, newtag) {
+		return errors.Context(errors.ErrIllegal, "tag already exists (use merge instead): "+cat+tagSeparator+newtag)
+	}
+	// Objects are opened before making changes, such that no object is left inconsistent with the tags.
+	objects, err := r.openObjects()
+	if err != nil {
+		return err
+	}
+	dir := r.tagdir(cat, tag)
+	newdir := filepath.Join(r.tagdir(cat, parentTag(newtag)), tagName(newtag))
+	if err := os.MkdirAll(filepath.Join(r.location, filepath.Dir(newdir)), 0o700); err != nil {
+		return errors.Context(err, "failed to create parent tag directory")
+	}
+	if err := os.Rename(filepath.Join(r.location, dir), filepath.Join(r.location, newdir)); err != nil {
+		return errors.Context(err, "failed to rename tag directory")
+	}
+	if tagdepth(key) != tagdepth(newkey) {
+		// Relative symlink targets depend on the depth of the tag-directory.
+		if err := r.relinkTagTree(newdir, tagdepth(newkey)); err != nil {
+			return err
+		}
+	}
+	if newkey != key {
+		if err := r.updateObjects(objects, func(obj *RepoObj) bool { return obj.moveTag(catkey, key, newkey) }); err != nil {
+			return err
+		}
+	}
+	return r.reload()
+}
+
+// MergeTag merges tag into tag `into` in category cat, including its nested tags. Symlinks are moved and the
+// properties of tagged objects are updated, after which tag is removed. Tag `into` is created if it does not
+// exist.
+func (r *Repo) MergeTag(cat, tag, into string) error {
+	if !validCategoryName(cat) || !validTagPath(tag) || !validTagPath(into) {
+		return errors.Context(errors.ErrIllegal, "invalid category or tag")
+	}
+	catkey, key, intokey := sanitizeName(cat), sanitizeTagPath(tag), sanitizeTagPath(into)
+	if intokey == key || strings.HasPrefix(intokey, key+tagSeparator) || strings.HasPrefix(key, intokey+tagSeparator) {
+		return errors.Context(errors.ErrIllegal, "cannot merge tag '"+tag+"' with itself, its ancestor or nested tag '"+into+"'")
+	}
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !r.hasTag(cat, tag) {
+		return errors.Context(errors.ErrIllegal, "tag does not exist: "+cat+tagSeparator+tag)
+	}
+	// Objects are opened before making changes, such that no object is left inconsistent with the tags.
+	objects, err := r.openObjects()
+	if err != nil {
+		return err
+	}
+	if err := r.mergeTagTree(cat, r.tagdir(cat, tag), into); err != nil {
+		return err
+	}
+	if err := r.updateObjects(objects, func(obj *RepoObj) bool { return obj.moveTag(catkey, key, intokey) }); err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+// mergeTagTree moves the symlinks of the tag-directory dir, and recursively of its nested tag-directories,
+// into tag `into`, then removes the tag-directory. Directory dir is relative to the repository root.
+func (r *Repo) mergeTagTree(cat, dir, into string) error {
+	path, intopath := filepath.Join(r.location, dir), filepath.Join(r.location, r.tagdir(cat, into))
+	if err := os.MkdirAll(intopath, 0o700); err != nil {
+		return errors.Context(err, "failed to create tag directory")
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return errors.Context(err, "failed to open tag directory")
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			if err := r.mergeTagTree(cat, filepath.Join(dir, e.Name()), into+tagSeparator+e.Name()); err != nil {
+				return err
+			}
+			continue
+		}
+		if e.Type()&os.ModeSymlink == 0 {
+			return errors.Context(errors.ErrIllegal, "foreign object in tag directory: "+filepath.Join(path, e.Name()))
+		}
+		linkpath, intolinkpath := filepath.Join(path, e.Name()), filepath.Join(intopath, e.Name())
+		target, err := os.Readlink(linkpath)
+		if err != nil {
+			return errors.Context(err, "failed to query symlink "+linkpath)
+		}
+		id := filepath.Base(target)
+		if existing, err := os.Readlink(intolinkpath); err == nil {
+			if filepath.Base(existing) != id {
+				return errors.Context(errors.ErrIllegal, "symlink '"+e.Name()+"' in tag '"+into+"' refers to a different object")
+			}
+		} else if err := os.Symlink(r.linktarget(tagdepth(into), id), intolinkpath); err != nil {
+			return errors.Context(err, "failed to create symlink in tag '"+into+"'")
+		}
+		if err := os.Remove(linkpath); err != nil {
+			return errors.Context(err, "failed to remove symlink "+linkpath)
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return errors.Context(err, "failed to remove merged tag directory")
+	}
+	return nil
+}
+
+// DeleteTag deletes tag in category cat, including its nested tags, and removes the tag from the properties of
+// tagged objects. Tag-directories may only contain symlinks and nested tag-directories.
+func (r *Repo) DeleteTag(cat, tag string) error {
+	if !validCategoryName(cat) || !validTagPath(tag) {
+		return errors.Context(errors.ErrIllegal, "invalid category or tag")
+	}
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !r.hasTag(cat, tag) {
+		return errors.Context(errors.ErrIllegal, "tag does not exist: "+cat+tagSeparator+tag)
+	}
+	// Objects are opened before making changes, such that no object is left inconsistent with the tags.
+	objects, err := r.openObjects()
+	if err != nil {
+		return err
+	}
+	if err := removeTagTree(filepath.Join(r.location, r.tagdir(cat, tag))); err != nil {
+		return err
+	}
+	catkey, key := sanitizeName(cat), sanitizeTagPath(tag)
+	if err := r.updateObjects(objects, func(obj *RepoObj) bool {
+		var changed bool
+		for _, t := range slices.Clone(obj.Tags[catkey]) {
+			if t == key || strings.HasPrefix(t, key+tagSeparator) {
+				changed = obj.removeTag(catkey, t) || changed
+			}
+		}
+		return changed
+	}); err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+// DeleteCategory deletes category cat including all of its tags, and removes the tags from the properties of
+// tagged objects.
+func (r *Repo) DeleteCategory(cat string) error {
+	if !validCategoryName(cat) {
+		return errors.Context(errors.ErrIllegal, "invalid category: "+cat)
+	}
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !r.hasCategory(cat) {
+		return errors.Context(errors.ErrIllegal, "category does not exist: "+cat)
+	}
+	// Objects are opened before making changes, such that no object is left inconsistent with the tags.
+	objects, err := r.openObjects()
+	if err != nil {
+		return err
+	}
+	if err := removeTagTree(filepath.Join(r.location, r.tagdir(cat, ""))); err != nil {
+		return err
+	}
+	key := sanitizeName(cat)
+	if err := r.updateObjects(objects, func(obj *RepoObj) bool {
+		if len(obj.Tags[key]) == 0 {
+			return false
+		}
+		delete(obj.Tags, key)
+		return true
+	}); err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+// removeTagTree removes a tag-directory with its symlinks and nested tag-directories. Nothing is removed if a
+// foreign object, i.e. neither symlink nor directory, is present.
+func removeTagTree(path string) error {
+	if err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Type()&os.ModeSymlink == 0 {
+			return errors.Context(errors.ErrIllegal, "foreign object in tag directory: "+p)
+		}
+		return nil
+	}); err != nil {
+		return errors.Context(err, "refusing to remove tag directory")
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return errors.Context(err, "failed to remove tag directory")
+	}
+	return nil
+}
+
+// relinkTagTree redirects the symlinks in the tag-directory dir, at the specified depth, and in its nested
+// tag-directories, according to the depth of the tag-directory. Directory dir is relative to the repository
+// root.
+func (r *Repo) relinkTagTree(dir string, depth int) error {
+	path := filepath.Join(r.location, dir)
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return errors.Context(err, "failed to open tag directory")
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			if err := r.relinkTagTree(filepath.Join(dir, e.Name()), depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if e.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		linkpath := filepath.Join(path, e.Name())
+		target, err := os.Readlink(linkpath)
+		if err != nil {
+			return errors.Context(err, "failed to query symlink "+linkpath)
+		}
+		if expected := r.linktarget(depth, filepath.Base(target)); target != expected {
+			if err := os.Remove(linkpath); err != nil {
+				return errors.Context(err, "failed to remove symlink "+linkpath)
+			}
+			if err := os.Symlink(expected, linkpath); err != nil {
+				return errors.Context(err, "failed to create symlink "+linkpath)
+			}
+		}
+	}
+	return nil
+}
+
+// moveTag replaces tag, and its nested tags, with tag `into` in category cat. Returns true if any tag was
+// replaced.
+func (o *RepoObj) moveTag(cat, tag, into string) bool {
+	var changed bool
+	for _, t := range slices.Clone(o.Tags[cat]) {
+		if t == tag || strings.HasPrefix(t, tag+tagSeparator) {
+			o.removeTag(cat, t)
+			o.addTag(cat, into+strings.TrimPrefix(t, tag))
+			changed = true
+		}
+	}
+	return changed
+}
+
+// openObjects opens all objects, for updating their properties after changes to the tags, see
+// `updateObjects`. If any object cannot be opened, an error is returned that lists all such objects, such that
+// the operation is refused before changes are made, instead of leaving these objects with outdated tags.
+func (r *Repo) openObjects() ([]RepoObj, error) {
+	entries, err := r.readRepoEntries()
+	if err != nil {
+		return nil, err
+	}
+	var objects []RepoObj
+	var failures []error
+	for _, e := range entries {
+		if !r.isObjectEntry(e) {
+			continue
+		}
+		obj, err := r.openObject(e.Name())
+		if err != nil {
+			failures = append(failures, err)
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	if len(failures) > 0 {
+		return nil, errors.Aggregate(failures[0], "failed to open repo-objects, no changes made (use 'check' to restore)",
+			failures[1:]...)
+	}
+	return objects, nil
+}
+
+// updateObjects applies update to objects, and writes the properties of objects that were changed.
+func (r *Repo) updateObjects(objects []RepoObj, update func(obj *RepoObj) bool) error {
+	for i := range objects {
+		if !update(&objects[i]) {
+			continue
+		}
+		if err := r.writeProperties(&objects[i]); err != nil {
+			return errors.Context(err, "failed to update properties of "+objects[i].Id)
+		}
+	}
+	return nil
+}
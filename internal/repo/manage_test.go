@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	os_ "github.com/cobratbq/goutils/std/os"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestManageTagsRefusedForUnopenedObject(t *testing.T) {
+	testdata := []struct {
+		name   string
+		op     func(r *Repo) error
+		tagged [2]string
+	}{
+		{"rename category", func(r *Repo) error { return r.RenameCategory("topic", "subject") }, [2]string{"subject", "crypto"}},
+		{"rename tag", func(r *Repo) error { return r.RenameTag("topic", "crypto", "cryptography") }, [2]string{"topic", "cryptography"}},
+		{"merge tag", func(r *Repo) error { return r.MergeTag("topic", "crypto", "security") }, [2]string{"topic", "security"}},
+		{"delete tag", func(r *Repo) error { return r.DeleteTag("topic", "crypto") }, [2]string{}},
+		{"delete category", func(r *Repo) error { return r.DeleteCategory("topic") }, [2]string{}},
+	}
+	for _, d := range testdata {
+		location := filepath.Join(t.TempDir(), "repo")
+		r, err := InitRepository(location, InitOptions{Starters: []string{"topic/crypto", "topic/security"}})
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.name)
+		obj, _, err := r.Acquire(strings.NewReader("tagged"), "tagged.pdf")
+		assert.Nil(t, err)
+		assert.Nil(t, r.Tag("topic", "crypto", &obj))
+		other, _, err := r.Acquire(strings.NewReader("other"), "other.pdf")
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.name)
+		// An object that cannot be opened prevents any change.
+		propspath := r.repofilepath(other.Id) + repoPropertiesSuffix
+		data, err := os.ReadFile(propspath)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(propspath, append(data, "invalid line\n"...), 0o600))
+		assert.NotNil(t, d.op(r))
+		assert.True(t, os_.ExistsIsDirectory(filepath.Join(location, "topic", "crypto")))
+		opened, err := r.OpenObject(obj.Id)
+		assert.Nil(t, err)
+		assert.True(t, opened.HasTag("topic", "crypto"))
+		// With all objects accessible, the operation is applied to tag-directories and properties.
+		assert.Nil(t, os.WriteFile(propspath, data, 0o600))
+		assert.Nil(t, d.op(r))
+		assert.False(t, os_.ExistsIsDirectory(filepath.Join(location, "topic", "crypto")))
+		opened, err = r.OpenObject(obj.Id)
+		assert.Nil(t, err)
+		assert.False(t, opened.HasTag("topic", "crypto"))
+		if d.tagged[0] != "" {
+			assert.True(t, opened.HasTag(d.tagged[0], d.tagged[1]))
+		} else {
+			assert.Equal(t, 0, len(opened.Categories()))
+		}
+		assert.LogOnFailure(t, d.name)
+	}
+}
@@ -0,0 +1,365 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"maps"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+	"golang.org/x/text/language"
+)
+
+// Bibliographic metadata fields. The field name is also the key of the property in the properties-file.
+const (
+	FieldAuthors   = "authors"
+	FieldTitle     = "title"
+	FieldYear      = "year"
+	FieldPublisher = "publisher"
+	FieldDOI       = "doi"
+	FieldISBN      = "isbn"
+	FieldURL       = "url"
+	FieldLanguage  = "language"
+	FieldNotes     = "notes"
+	// authorsSeparator separates authors in the value of the authors-property. As authors are commonly written
+	// as `<family>, <given>`, the comma is not suitable as separator.
+	authorsSeparator = ";"
+)
+
+// MetadataFields returns the names of the bibliographic metadata fields, in order of presentation.
+func MetadataFields() []string {
+	return []string{FieldAuthors, FieldTitle, FieldYear, FieldPublisher, FieldDOI, FieldISBN, FieldURL,
+		FieldLanguage, FieldNotes}
+}
+
+func isMetadataField(field string) bool {
+	switch field {
+	case FieldAuthors, FieldTitle, FieldYear, FieldPublisher, FieldDOI, FieldISBN, FieldURL, FieldLanguage, FieldNotes:
+		return true
+	default:
+		return false
+	}
+}
+
+// Metadata is the bibliographic metadata of a repository object. Empty (zero) values indicate absent fields.
+type Metadata struct {
+	Authors   []string
+	Title     string
+	Year      int
+	Publisher string
+	// DOI is the Digital Object Identifier, without resolver-prefix, e.g. `10.1000/182`.
+	DOI string
+	// ISBN is the ISBN-10 or ISBN-13, without separators.
+	ISBN string
+	URL  string
+	// Language is the BCP 47 language tag, e.g. `en` or `pt-BR`.
+	Language string
+	// Notes is free-form text, possibly spanning multiple lines.
+	Notes string
+	// invalid holds, by field, values that were read from the properties but are invalid. These are preserved,
+	// such that the object remains accessible and the value can be corrected, until the field is set.
+	invalid map[string]string
+}
+
+// Get returns the value of field in its textual representation, as accepted by `Set`.
+func (m *Metadata) Get(field string) string {
+	if value, ok := m.invalid[field]; ok {
+		return value
+	}
+	switch field {
+	case FieldAuthors:
+		return strings.Join(m.Authors, authorsSeparator+" ")
+	case FieldTitle:
+		return m.Title
+	case FieldYear:
+		if m.Year == 0 {
+			return ""
+		}
+		return strconv.Itoa(m.Year)
+	case FieldPublisher:
+		return m.Publisher
+	case FieldDOI:
+		return m.DOI
+	case FieldISBN:
+		return m.ISBN
+	case FieldURL:
+		return m.URL
+	case FieldLanguage:
+		return m.Language
+	case FieldNotes:
+		return m.Notes
+	default:
+		return ""
+	}
+}
+
+// Set validates and sets the value of field from its textual representation. Values are normalized, e.g. a
+// DOI is stripped of its resolver-prefix and an ISBN of its separators. An empty value clears the field.
+func (m *Metadata) Set(field, value string) error {
+	value = strings.TrimSpace(value)
+	if field != FieldNotes && strings.ContainsAny(value, "\n\r") {
+		return errors.Context(errors.ErrIllegal, field+": value must be a single line")
+	}
+	switch field {
+	case FieldAuthors:
+		var authors []string
+		for _, a := range strings.Split(value, authorsSeparator) {
+			if a = strings.TrimSpace(a); a != "" {
+				authors = append(authors, a)
+			}
+		}
+		m.Authors = authors
+	case FieldTitle:
+		m.Title = value
+	case FieldYear:
+		year, err := parseYear(value)
+		if err != nil {
+			return err
+		}
+		m.Year = year
+	case FieldPublisher:
+		m.Publisher = value
+	case FieldDOI:
+		doi, err := normalizeDOI(value)
+		if err != nil {
+			return err
+		}
+		m.DOI = doi
+	case FieldISBN:
+		isbn, err := normalizeISBN(value)
+		if err != nil {
+			return err
+		}
+		m.ISBN = isbn
+	case FieldURL:
+		if err := validateURL(value); err != nil {
+			return err
+		}
+		m.URL = value
+	case FieldLanguage:
+		lang, err := normalizeLanguage(value)
+		if err != nil {
+			return err
+		}
+		m.Language = lang
+	case FieldNotes:
+		m.Notes = strings.ReplaceAll(value, "\r\n", "\n")
+	default:
+		return errors.Context(errors.ErrIllegal, "unknown metadata field: "+field)
+	}
+	if _, ok := m.invalid[field]; ok {
+		// The map may be shared with copies of the metadata.
+		m.invalid = maps.Clone(m.invalid)
+		delete(m.invalid, field)
+	}
+	return nil
+}
+
+// setLenient sets the value of field as `Set` does, but preserves an invalid value as is. The result is the
+// validation error, if any.
+func (m *Metadata) setLenient(field, value string) error {
+	err := m.Set(field, value)
+	if err != nil {
+		if m.invalid == nil {
+			m.invalid = map[string]string{}
+		}
+		m.invalid[field] = value
+	}
+	return err
+}
+
+// Validate checks all fields of the metadata, including invalid values that were preserved upon reading.
+func (m *Metadata) Validate() error {
+	for _, field := range MetadataFields() {
+		if err := m.validateField(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateChanges checks the fields of which the value differs from previous. Invalid values that were
+// preserved upon reading, and left unchanged, therefore do not prevent changes to other fields.
+func (m *Metadata) validateChanges(previous *Metadata) error {
+	for _, field := range MetadataFields() {
+		if m.Get(field) == previous.Get(field) {
+			continue
+		}
+		if err := m.validateField(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Metadata) validateField(field string) error {
+	var check Metadata
+	if err := check.Set(field, m.Get(field)); err != nil {
+		return err
+	}
+	if check.Get(field) != m.Get(field) {
+		return errors.Context(errors.ErrIllegal, field+": value is not in normalized form: "+m.Get(field))
+	}
+	return nil
+}
+
+// fill sets the fields from values, by field name, as imported from source. Fields that are present are only
+// replaced if overwrite is set. Invalid values are skipped, with a warning. The result indicates whether the
+// metadata was changed.
+func (m *Metadata) fill(values map[string]string, source string, overwrite bool) bool {
+	var changed bool
+	for _, field := range MetadataFields() {
+		value := values[field]
+		if value == "" || (!overwrite && m.Get(field) != "") {
+			continue
+		}
+		var check Metadata
+		if err := check.Set(field, value); err != nil {
+			log.Warnln("Skipping field of", source+":", err.Error())
+			continue
+		}
+		if check.Get(field) == m.Get(field) {
+			continue
+		}
+		m.Set(field, value)
+		changed = true
+	}
+	return changed
+}
+
+// ValidateMetadata checks value for field, without setting it.
+func ValidateMetadata(field, value string) error {
+	var m Metadata
+	return m.Set(field, value)
+}
+
+func parseYear(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	year, err := strconv.Atoi(value)
+	if err != nil || year < 1 || year > 9999 {
+		return 0, errors.Context(errors.ErrIllegal, FieldYear+": expected year between 1 and 9999: "+value)
+	}
+	return year, nil
+}
+
+var doiPattern = regexp.MustCompile(`^10\.\d{4,9}/\S+$`)
+
+// normalizeDOI strips resolver-prefixes, i.e. `doi:` and `https://doi.org/`, and checks the DOI syntax.
+func normalizeDOI(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	doi := value
+	for _, prefix := range []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/", "doi:"} {
+		if len(doi) >= len(prefix) && strings.EqualFold(doi[:len(prefix)], prefix) {
+			doi = strings.TrimSpace(doi[len(prefix):])
+			break
+		}
+	}
+	if !doiPattern.MatchString(doi) {
+		return "", errors.Context(errors.ErrIllegal, FieldDOI+": expected DOI of the form 10.<registrant>/<suffix>: "+value)
+	}
+	return doi, nil
+}
+
+// normalizeISBN strips separators and checks the check-digit of an ISBN-10 or ISBN-13.
+func normalizeISBN(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(value))
+	var valid bool
+	switch len(isbn) {
+	case 10:
+		var sum int
+		for i, c := range isbn {
+			d := int(c - '0')
+			if c == 'X' && i == 9 {
+				d = 10
+			} else if c < '0' || c > '9' {
+				sum = -1
+				break
+			}
+			sum += (10 - i) * d
+		}
+		valid = sum >= 0 && sum%11 == 0
+	case 13:
+		var sum int
+		for i, c := range isbn {
+			if c < '0' || c > '9' {
+				sum = -1
+				break
+			}
+			sum += int(c-'0') * (1 + 2*(i%2))
+		}
+		valid = sum >= 0 && sum%10 == 0
+	}
+	if !valid {
+		return "", errors.Context(errors.ErrIllegal, FieldISBN+": expected valid ISBN-10 or ISBN-13: "+value)
+	}
+	return isbn, nil
+}
+
+func validateURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" || strings.ContainsAny(value, " \t") {
+		return errors.Context(errors.ErrIllegal, FieldURL+": expected absolute URL: "+value)
+	}
+	return nil
+}
+
+// normalizeLanguage checks and canonicalizes a BCP 47 language tag.
+func normalizeLanguage(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", errors.Context(errors.ErrIllegal, FieldLanguage+": expected BCP 47 language tag, e.g. 'en': "+value)
+	}
+	return tag.String(), nil
+}
+
+// escapeMultiline escapes backslashes and line-endings, such that a multi-line value fits on a single line of
+// the properties-file.
+func escapeMultiline(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(value)
+}
+
+func unescapeMultiline(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			if value[i] == 'n' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// writeMetadata appends the properties of the metadata fields that are present.
+func writeMetadata(buffer []byte, m *Metadata) []byte {
+	for _, field := range MetadataFields() {
+		value := m.Get(field)
+		if value == "" {
+			continue
+		}
+		if field == FieldNotes {
+			value = escapeMultiline(value)
+		}
+		buffer = append(buffer, field+"="+value+"\n"...)
+	}
+	return buffer
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cobratbq/goutils/std/errors"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestMetadataSet(t *testing.T) {
+	testdata := []struct {
+		field    string
+		value    string
+		expected string
+	}{
+		{FieldAuthors, " Doe, John ;; Smith, Jane;", "Doe, John; Smith, Jane"},
+		{FieldYear, "2021", "2021"},
+		{FieldYear, "", ""},
+		{FieldDOI, "https://doi.org/10.1000/182", "10.1000/182"},
+		{FieldDOI, "doi:10.1000/182", "10.1000/182"},
+		{FieldISBN, "978-3-16-148410-0", "9783161484100"},
+		{FieldISBN, "0-306-40615-2", "0306406152"},
+		{FieldLanguage, "en-gb", "en-GB"},
+		{FieldURL, "https://example.org/a", "https://example.org/a"},
+		{FieldNotes, "line\r\nline", "line\nline"},
+	}
+	for _, d := range testdata {
+		var m Metadata
+		assert.Nil(t, m.Set(d.field, d.value))
+		assert.Equal(t, d.expected, m.Get(d.field))
+		assert.Nil(t, m.Validate())
+		assert.LogOnFailure(t, d.field, d.value)
+	}
+}
+
+func TestMetadataSetInvalid(t *testing.T) {
+	testdata := [][2]string{
+		{FieldYear, "twenty"},
+		{FieldYear, "0"},
+		{FieldDOI, "11.1000/182"},
+		{FieldISBN, "978-3-16-148410-1"},
+		{FieldISBN, "12345"},
+		{FieldURL, "example.org"},
+		{FieldLanguage, "not a language"},
+		{FieldTitle, "two\nlines"},
+		{"unknown", "value"},
+	}
+	for _, d := range testdata {
+		var m Metadata
+		assert.IsError(t, errors.ErrIllegal, m.Set(d[0], d[1]))
+		assert.LogOnFailure(t, d[0], d[1])
+	}
+}
+
+func TestSaveInvalidMetadata(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	obj, _, err := r.Acquire(strings.NewReader("content"), "paper.pdf")
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	path := r.repofilepath(obj.Id) + repoPropertiesSuffix
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, append(data, "isbn=12345\nyear=MMXXI\n"...), 0o600))
+	assert.StopOnFailure(t)
+	// Invalid values are preserved, and reported.
+	obj, err = r.OpenObject(obj.Id)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	assert.Equal(t, "12345", obj.Meta.Get(FieldISBN))
+	assert.IsError(t, errors.ErrIllegal, obj.Meta.Validate())
+	// Invalid values do not prevent changes to other fields.
+	assert.Nil(t, obj.Meta.Set(FieldTitle, "Paper"))
+	assert.Nil(t, r.Save(obj))
+	obj, err = r.OpenObject(obj.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Paper", obj.Meta.Title)
+	assert.Equal(t, "12345", obj.Meta.Get(FieldISBN))
+	assert.Equal(t, "MMXXI", obj.Meta.Get(FieldYear))
+	// Invalid values are corrected, or cleared, by setting the field.
+	assert.Nil(t, obj.Meta.Set(FieldISBN, ""))
+	assert.Nil(t, obj.Meta.Set(FieldYear, "2021"))
+	assert.Nil(t, r.Save(obj))
+	obj, err = r.OpenObject(obj.Id)
+	assert.Nil(t, err)
+	assert.Nil(t, obj.Meta.Validate())
+	assert.Equal(t, 2021, obj.Meta.Year)
+	// Changed fields are validated.
+	invalid := obj
+	invalid.Meta.invalid = map[string]string{FieldDOI: "not a DOI"}
+	assert.IsError(t, errors.ErrIllegal, r.Save(invalid))
+}
+
+func TestSaveSchemaViolation(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	r, err := InitRepository(location, InitOptions{})
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	obj, _, err := r.Acquire(strings.NewReader("content"), "paper.pdf")
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	// The schema is introduced after the object exists, therefore the object violates it.
+	assert.Nil(t, os.WriteFile(filepath.Join(location, schemaFilename), []byte("pages=int;required\n"), 0o600))
+	assert.Nil(t, r.Reload())
+	assert.StopOnFailure(t)
+	obj, err = r.OpenObject(obj.Id)
+	assert.Nil(t, err)
+	assert.NotNil(t, r.Schema().Validate(&obj.Props))
+	assert.Nil(t, obj.Meta.Set(FieldTitle, "Paper"))
+	assert.Nil(t, r.Save(obj))
+	assert.Nil(t, obj.Props.Set("pages", "many"))
+	assert.NotNil(t, r.Save(obj))
+	assert.Nil(t, obj.Props.Set("pages", "12"))
+	assert.Nil(t, r.Save(obj))
+}
@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+)
+
+// ErrMigrationRequired indicates that the repository is in an older format and must be migrated before use.
+var ErrMigrationRequired = errors.NewStringError("repository format is outdated, migration required")
+
+// migration is an upgrade step of the repository format from one version to the next.
+type migration struct {
+	from        string
+	to          string
+	description string
+	apply       func(m *migrator) error
+}
+
+// migrations lists the upgrade steps, in order. Each step upgrades the repository by one format version, such
+// that a repository of any older version is upgraded by applying the subsequent steps in sequence.
+var migrations = []migration{
+	{from: "0", to: "1", description: "rewrite properties with 'tags;'-prefixed tags and properties version 1",
+		apply: migrateProperties0To1},
+	// Version 2 introduces the object layout. Existing repositories have the flat layout, which is recorded
+	// together with the version.
+	{from: "1", to: "2", description: "record flat object layout", apply: func(*migrator) error { return nil }},
+}
+
+// supportedVersion checks whether the repository format version is either current or can be migrated.
+func supportedVersion(v string) bool {
+	if v == configVersion {
+		return true
+	}
+	for _, m := range migrations {
+		if m.from == v {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateReport is the result of migrating a repository.
+type MigrateReport struct {
+	// DryRun indicates that changes were only planned, not applied.
+	DryRun bool
+	// From is the format version of the repository before migration.
+	From string
+	// To is the format version of the repository after migration.
+	To string
+	// Steps lists the descriptions of the upgrade steps that were applied (or planned, in case of a dry-run).
+	Steps []string
+	// Changes lists the file-system changes, in order, that were made (or planned, in case of a dry-run).
+	Changes []Change
+}
+
+// migrator performs the changes of upgrade steps. In case of a dry-run, changes are only recorded.
+type migrator struct {
+	repo   *Repo
+	report *MigrateReport
+}
+
+func (m *migrator) writeProperties(obj *RepoObj) error {
+	m.report.Changes = append(m.report.Changes, Change{Op: ChangeWriteProperties,
+		Path: m.repo.repofilepath(obj.Id) + repoPropertiesSuffix})
+	if m.report.DryRun {
+		return nil
+	}
+	// Properties of a rehashed object are written before the object is moved into its shard-directory.
+	if err := os.MkdirAll(filepath.Dir(m.repo.repofilepath(obj.Id)), 0o700); err != nil {
+		return err
+	}
+	return m.repo.writeProperties(obj)
+}
+
+func (m *migrator) rename(path, newpath string) error {
+	m.report.Changes = append(m.report.Changes, Change{Op: ChangeRename, Path: path, Target: newpath})
+	if m.report.DryRun {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(newpath), 0o700); err != nil {
+		return err
+	}
+	return os.Rename(path, newpath)
+}
+
+func (m *migrator) remove(path string) error {
+	m.report.Changes = append(m.report.Changes, Change{Op: ChangeRemove, Path: path})
+	if m.report.DryRun {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func (m *migrator) symlink(target, path string) error {
+	m.report.Changes = append(m.report.Changes, Change{Op: ChangeSymlink, Path: path, Target: target})
+	if m.report.DryRun {
+		return nil
+	}
+	return os.Symlink(target, path)
+}
+
+func (m *migrator) writeConfig(cfg *Config) error {
+	m.report.Changes = append(m.report.Changes, Change{Op: ChangeWriteProperties, Path: configpath(m.repo.location)})
+	if m.report.DryRun {
+		return nil
+	}
+	return writeConfig(m.repo.location, cfg)
+}
+
+// MigrateOptions are the options for migrating a repository, see `Migrate`.
+type MigrateOptions struct {
+	// DryRun plans changes without applying any of them.
+	DryRun bool
+	// Adopt adopts the directory as repository, if it is not a repository yet, see `AdoptRepository`.
+	Adopt bool
+}
+
+// Migrate upgrades the repository at location to the current format version, by applying the upgrade steps
+// in order. The resulting version is recorded in the repository marker-file after each step, such that an
+// interrupted migration continues with the step that did not complete. In case of a dry-run, changes are
+// planned but not applied, including the adoption of the directory.
+func Migrate(location string, opts MigrateOptions) (MigrateReport, error) {
+	dryRun := opts.DryRun
+	report := MigrateReport{DryRun: dryRun}
+	r, err := openRepository(location)
+	if errors.Is(err, ErrNotRepository) && opts.Adopt {
+		// Adoption writes the marker-file, therefore is planned instead in case of a dry-run.
+		report.Changes = append(report.Changes, Change{Op: ChangeWriteProperties, Path: configpath(location)})
+		if dryRun {
+			r, err = openRepositoryConfig(location, adoptedConfig())
+		} else if _, err = AdoptRepository(location); err == nil || errors.Is(err, ErrMigrationRequired) {
+			r, err = openRepository(location)
+		}
+	}
+	if err != nil {
+		return report, err
+	}
+	mode := LockExclusive
+	if dryRun {
+		mode = LockShared
+	}
+	unlock, err := r.lock(mode)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+	cfg := r.config
+	report.From, report.To = cfg.Version, cfg.Version
+	m := migrator{repo: r, report: &report}
+	for _, step := range migrations {
+		if step.from != report.To {
+			continue
+		}
+		log.Infoln("Migrating repository from version", step.from, "to", step.to+":", step.description)
+		if err := step.apply(&m); err != nil {
+			return report, errors.Context(err, "failed to migrate from version "+step.from+" to "+step.to)
+		}
+		cfg.Version = step.to
+		if err := m.writeConfig(&cfg); err != nil {
+			return report, errors.Context(err, "failed to record repository format version "+step.to)
+		}
+		report.Steps = append(report.Steps, step.description)
+		report.To = step.to
+	}
+	if report.To != configVersion {
+		return report, errors.Context(errors.ErrUnsupported, "no migration from repository format version "+report.To)
+	}
+	if !dryRun {
+		r.config = cfg
+	}
+	return report, nil
+}
+
+// migrateProperties0To1 rewrites the properties of all objects, such that legacy 'tags.'-prefixed properties
+// are converted to 'tags;'-prefixed properties and the properties version is updated. Properties that were
+// rewritten already, e.g. by an interrupted migration, are accepted.
+func migrateProperties0To1(m *migrator) error {
+	entries, err := m.repo.readRepoEntries()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !m.repo.isObjectEntry(e) {
+			continue
+		}
+		if _, err := os.Lstat(m.repo.repofilepath(e.Name() + repoPropertiesSuffix)); os.IsNotExist(err) {
+			log.Warnln("Skipping", e.Name(), ": properties are missing. (Use 'check' to restore.)")
+			continue
+		}
+		obj, err := m.repo.loadObject(e.Name(), "0", "1")
+		if err != nil {
+			return errors.Context(err, "failed to read properties of "+e.Name())
+		}
+		if err := m.writeProperties(&obj); err != nil {
+			return errors.Context(err, "failed to rewrite properties of "+e.Name())
+		}
+	}
+	return nil
+}
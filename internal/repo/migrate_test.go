@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cobratbq/goutils/std/errors"
+	os_ "github.com/cobratbq/goutils/std/os"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+// createOriginalRepository creates a repository in the original format, i.e. without marker-file and with
+// 'tags.'-prefixed tags, with a single object. It returns the identifier of the object.
+func createOriginalRepository(t *testing.T, location string) string {
+	for _, dir := range []string{subdirRepo, subdirTitles, filepath.Join("topic", "crypto"), filepath.Join("topic", "security")} {
+		assert.Nil(t, os.MkdirAll(filepath.Join(location, dir), 0o700))
+	}
+	path := filepath.Join(location, subdirRepo, "object")
+	assert.Nil(t, os.WriteFile(path, []byte("content"), 0o400))
+	checksum, err := Hash(HashBLAKE2b, path)
+	assert.Nil(t, err)
+	id := hex.EncodeToString(checksum)
+	assert.Nil(t, os.Rename(path, filepath.Join(location, subdirRepo, id)))
+	props := propVersion + "=0\n" + propHash + "=" + HashBLAKE2b + propHashspecSeparator + id + "\n" + propName +
+		"=x.pdf\n" + propTagsOldPrefix + "topic=crypto,security\ncustom=1\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(location, subdirRepo, id+repoPropertiesSuffix), []byte(props), 0o600))
+	for _, tag := range []string{"crypto", "security"} {
+		assert.Nil(t, os.Symlink(filepath.Join("..", "..", subdirRepo, id), filepath.Join(location, "topic", tag, "x.pdf")))
+	}
+	assert.StopOnFailure(t)
+	return id
+}
+
+func TestMigrate(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	id := createOriginalRepository(t, location)
+	_, err := OpenRepository(location)
+	assert.IsError(t, ErrNotRepository, err)
+	before := snapshot(t, location)
+	// Without adoption, a directory without marker-file is not migrated.
+	_, err = Migrate(location, MigrateOptions{})
+	assert.IsError(t, ErrNotRepository, err)
+	dryrun, err := Migrate(location, MigrateOptions{DryRun: true, Adopt: true})
+	assert.Nil(t, err)
+	assert.Equal(t, configVersionOriginal, dryrun.From)
+	assert.Equal(t, configVersion, dryrun.To)
+	assert.Equal(t, len(migrations), len(dryrun.Steps))
+	assert.Equal(t, len(before), len(snapshot(t, location)))
+	for path, entry := range snapshot(t, location) {
+		assert.Equal(t, before[path], entry)
+	}
+	assert.StopOnFailure(t)
+	report, err := Migrate(location, MigrateOptions{Adopt: true})
+	assert.Nil(t, err)
+	assert.SlicesEqual(t, dryrun.Steps, report.Steps)
+	assert.SlicesEqual(t, dryrun.Changes, report.Changes)
+	assert.StopOnFailure(t)
+	r, err := OpenRepository(location)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	assert.Equal(t, configVersion, r.Config().Version)
+	assert.Equal(t, LayoutFlat, r.Config().Layout)
+	obj, err := r.OpenObject(id)
+	assert.Nil(t, err)
+	assert.True(t, obj.HasTag("topic", "crypto"))
+	assert.True(t, obj.HasTag("topic", "security"))
+	custom, _ := obj.Props.Get("custom")
+	assert.Equal(t, "1", custom)
+	data, err := os.ReadFile(r.repofilepath(id) + repoPropertiesSuffix)
+	assert.Nil(t, err)
+	assert.Equal(t, propVersion+"="+version+"\n"+propHash+"="+HashBLAKE2b+propHashspecSeparator+id+"\n"+
+		propName+"=x.pdf\n"+propTags0Prefix+"topic=crypto/security\ncustom=1\n", string(data))
+	// A migrated repository is current, therefore migrating again makes no changes.
+	again, err := Migrate(location, MigrateOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(again.Steps))
+	assert.Equal(t, 0, len(again.Changes))
+}
+
+func TestMigrateInterrupted(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	id := createOriginalRepository(t, location)
+	// Properties that were rewritten already, e.g. by an interrupted migration, are accepted.
+	cfg := adoptedConfig()
+	assert.Nil(t, writeConfig(location, &cfg))
+	props := propVersion + "=" + version + "\n" + propHash + "=" + HashBLAKE2b + propHashspecSeparator + id + "\n" +
+		propName + "=x.pdf\n" + propTags0Prefix + "topic=crypto/security\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(location, subdirRepo, id+repoPropertiesSuffix), []byte(props), 0o600))
+	assert.StopOnFailure(t)
+	_, err := OpenRepository(location)
+	assert.IsError(t, ErrMigrationRequired, err)
+	report, err := Migrate(location, MigrateOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, configVersionOriginal, report.From)
+	assert.Equal(t, configVersion, report.To)
+	r, err := OpenRepository(location)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	obj, err := r.OpenObject(id)
+	assert.Nil(t, err)
+	assert.True(t, obj.HasTag("topic", "security"))
+}
+
+func TestMigrateUnsupportedVersion(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "repo")
+	assert.Nil(t, os.MkdirAll(location, 0o700))
+	assert.Nil(t, os.WriteFile(configpath(location), []byte(cfgVersion+"=99\n"+cfgHash+"="+HashBLAKE2b+"\n"), 0o600))
+	assert.StopOnFailure(t)
+	_, err := Migrate(location, MigrateOptions{})
+	assert.IsError(t, errors.ErrUnsupported, err)
+	assert.True(t, os_.ExistsFile(configpath(location)))
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"slices"
+	"strings"
+
+	bufio_ "github.com/cobratbq/goutils/std/bufio"
+	"github.com/cobratbq/goutils/std/errors"
+	strings_ "github.com/cobratbq/goutils/std/strings"
+)
+
+// Properties is an ordered map of properties. Properties that are read keep their position relative to the
+// known properties, and duplicate keys are retained, such that properties survive a round-trip through reading
+// and writing of the properties-file unchanged.
+type Properties struct {
+	entries []property
+}
+
+type property struct {
+	key   string
+	value string
+	// anchor is the key of the known property that preceded the property when read, or empty if none did.
+	anchor string
+	// anchored indicates whether the property was read, as opposed to set, hence has an anchor.
+	anchored bool
+}
+
+// Len returns the number of properties, counting duplicate keys once.
+func (p *Properties) Len() int {
+	return len(p.Keys())
+}
+
+// Keys returns the keys of the properties in order, without duplicates.
+func (p *Properties) Keys() []string {
+	var keys []string
+	for _, e := range p.entries {
+		if !slices.Contains(keys, e.key) {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys
+}
+
+// Get returns the value for key, and whether the key is present. Of duplicate keys, the last value applies.
+func (p *Properties) Get(key string) (string, bool) {
+	for i := len(p.entries) - 1; i >= 0; i-- {
+		if p.entries[i].key == key {
+			return p.entries[i].value, true
+		}
+	}
+	return "", false
+}
+
+// Set sets value for key. A new key is appended, an existing key keeps its position, with any duplicates
+// removed. Known (typed) properties of repo-objects cannot be set as general properties.
+func (p *Properties) Set(key, value string) error {
+	if err := validateProperty(key, value); err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(p.entries, func(e property) bool { return e.key == key })
+	if idx < 0 {
+		p.entries = append(p.entries, property{key: key, value: value})
+		return nil
+	}
+	p.entries[idx].value = value
+	p.entries = append(p.entries[:idx+1], slices.DeleteFunc(p.entries[idx+1:], func(e property) bool {
+		return e.key == key
+	})...)
+	return nil
+}
+
+// Delete removes key, including any duplicates, from the properties, if present.
+func (p *Properties) Delete(key string) {
+	p.entries = slices.DeleteFunc(p.entries, func(e property) bool { return e.key == key })
+}
+
+// add adds a property as read from a properties-file, following the known property with key anchor.
+func (p *Properties) add(key, value, anchor string) {
+	p.entries = append(p.entries, property{key: key, value: value, anchor: anchor, anchored: true})
+}
+
+// appendProperties appends the lines of the known properties in known to buffer, interleaved with the
+// properties, such that each property that was read is written after the known property that preceded it.
+// Remaining properties, i.e. those that were set or whose anchor is absent, are appended at the end.
+func (p *Properties) appendProperties(buffer, known []byte) []byte {
+	written := make([]bool, len(p.entries))
+	appendAnchored := func(anchor string) {
+		for i, e := range p.entries {
+			if !written[i] && e.anchored && e.anchor == anchor {
+				buffer = append(buffer, e.key+"="+e.value+"\n"...)
+				written[i] = true
+			}
+		}
+	}
+	appendAnchored("")
+	for _, line := range strings.SplitAfter(string(known), "\n") {
+		if line == "" {
+			continue
+		}
+		buffer = append(buffer, line...)
+		key, _, _ := strings.Cut(line, "=")
+		appendAnchored(key)
+	}
+	for i, e := range p.entries {
+		if !written[i] {
+			buffer = append(buffer, e.key+"="+e.value+"\n"...)
+		}
+	}
+	return buffer
+}
+
+// readPropertiesFile reads the key-value pairs, in order, from a properties-file.
+func readPropertiesFile(path string) ([][2]string, error) {
+	return bufio_.OpenFileProcessStringLinesFunc(path, '\n', func(s string) ([2]string, error) {
+		// TODO fine-tuning trimming whitespace for comment-line matching
+		if len(s) == 0 || strings_.AnyPrefix(strings.TrimLeft(s, " \t"), "#", "!") {
+			return [2]string{}, bufio_.ErrProcessingIgnore
+		}
+		// TODO support ':' separator?
+		if key, value, ok := strings.Cut(s, "="); ok {
+			return [...]string{strings.TrimSpace(key), strings.TrimSpace(value)}, nil
+		}
+		return [2]string{}, errors.ErrIllegal
+	})
+}
+
+// validateProperty checks that a key-value pair can be represented in the properties-file, i.e. is read back
+// unchanged, and that the key is not one of the known properties, which are represented as typed fields of
+// RepoObj.
+func validateProperty(key, value string) error {
+	if key == "" || strings.TrimSpace(key) != key || strings.ContainsAny(key, "=\n\r") || strings_.AnyPrefix(key, "#", "!") {
+		return errors.Context(errors.ErrIllegal, "invalid property key: "+key)
+	}
+	if strings.TrimSpace(value) != value || strings.ContainsAny(value, "\n\r") {
+		return errors.Context(errors.ErrIllegal, "invalid value for property "+key)
+	}
+	if isKnownProperty(key) {
+		return errors.Context(errors.ErrIllegal, "property is known and must be set through its field: "+key)
+	}
+	return nil
+}
+
+func isKnownProperty(key string) bool {
+	return key == propVersion || key == propHash || key == propName || key == propAliases || key == propCiteKey ||
+		isMetadataField(key) ||
+		strings_.AnyPrefix(key, propTagsOldPrefix, propTags0Prefix)
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cobratbq/goutils/std/errors"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestPropertiesRoundTrip(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"), InitOptions{Starters: []string{"topic/crypto"}})
+	assert.Nil(t, err)
+	obj, _, err := r.Acquire(strings.NewReader("x"), "x.pdf")
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	propspath := r.repofilepath(obj.Id) + repoPropertiesSuffix
+	data, err := os.ReadFile(propspath)
+	assert.Nil(t, err)
+	// header consists of the lines for version, hash and name.
+	header := strings.SplitAfter(string(data), "\n")
+	assert.Equal(t, 4, len(header))
+	assert.StopOnFailure(t)
+	version, hash, name := header[0], header[1], header[2]
+	testdata := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"none", version + hash + name, version + hash + name},
+		{"unknown after name", version + hash + name + "custom=1\n", version + hash + name + "custom=1\n"},
+		{"unknown before version", "custom=1\n" + version + hash + name, "custom=1\n" + version + hash + name},
+		{"unknown between known", version + "custom=1\n" + hash + name, version + "custom=1\n" + hash + name},
+		{"order of unknown", version + hash + name + "b=2\na=1\nc=3\n", version + hash + name + "b=2\na=1\nc=3\n"},
+		{"duplicates", version + hash + name + "custom=1\nother=x\ncustom=2\n", version + hash + name + "custom=1\nother=x\ncustom=2\n"},
+		{"unknown between tags", version + hash + name + "tags;status=read\ncustom=1\ntags;topic=crypto\n",
+			version + hash + name + "tags;status=read\ncustom=1\ntags;topic=crypto\n"},
+		{"unknown after metadata", version + hash + name + "title=Title\ncustom=1\nyear=2020\n",
+			version + hash + name + "title=Title\ncustom=1\nyear=2020\n"},
+		{"colon in key", version + hash + name + "dc:creator=someone\n", version + hash + name + "dc:creator=someone\n"},
+		{"empty value", version + hash + name + "custom=\n", version + hash + name + "custom=\n"},
+		{"whitespace is trimmed", version + hash + name + " custom = 1 \n", version + hash + name + "custom=1\n"},
+		{"comments are dropped", version + hash + name + "# comment\n!comment\ncustom=1\n", version + hash + name + "custom=1\n"},
+	}
+	for _, d := range testdata {
+		assert.Nil(t, os.WriteFile(propspath, []byte(d.input), 0o600))
+		obj, err := r.OpenObject(obj.Id)
+		assert.Nil(t, err)
+		assert.Nil(t, r.writeProperties(&obj))
+		data, err := os.ReadFile(propspath)
+		assert.Nil(t, err)
+		assert.Equal(t, d.expected, string(data))
+		assert.LogOnFailure(t, d.name)
+	}
+}
+
+func TestPropertiesSetDelete(t *testing.T) {
+	testdata := []struct {
+		name     string
+		read     [][2]string
+		update   func(p *Properties) error
+		expected string
+		keys     []string
+	}{
+		{"set new", nil, func(p *Properties) error { return p.Set("a", "1") }, "a=1\n", []string{"a"}},
+		{"set appends", [][2]string{{"b", "2"}}, func(p *Properties) error { return p.Set("a", "1") },
+			"b=2\na=1\n", []string{"b", "a"}},
+		{"set keeps position", [][2]string{{"a", "1"}, {"b", "2"}}, func(p *Properties) error { return p.Set("a", "3") },
+			"a=3\nb=2\n", []string{"a", "b"}},
+		{"set removes duplicates", [][2]string{{"a", "1"}, {"b", "2"}, {"a", "3"}},
+			func(p *Properties) error { return p.Set("a", "4") }, "a=4\nb=2\n", []string{"a", "b"}},
+		{"delete removes duplicates", [][2]string{{"a", "1"}, {"b", "2"}, {"a", "3"}},
+			func(p *Properties) error { p.Delete("a"); return nil }, "b=2\n", []string{"b"}},
+		{"delete absent", [][2]string{{"a", "1"}}, func(p *Properties) error { p.Delete("b"); return nil },
+			"a=1\n", []string{"a"}},
+		{"set empty value", nil, func(p *Properties) error { return p.Set("a", "") }, "a=\n", []string{"a"}},
+	}
+	for _, d := range testdata {
+		var p Properties
+		for _, e := range d.read {
+			p.add(e[0], e[1], "")
+		}
+		assert.Nil(t, d.update(&p))
+		assert.Equal(t, d.expected, string(p.appendProperties(nil, nil)))
+		assert.SlicesEqual(t, d.keys, p.Keys())
+		assert.Equal(t, len(d.keys), p.Len())
+		assert.LogOnFailure(t, d.name)
+	}
+}
+
+func TestPropertiesGet(t *testing.T) {
+	var p Properties
+	p.add("a", "1", "")
+	p.add("b", "2", "")
+	p.add("a", "3", "")
+	testdata := []struct {
+		key     string
+		value   string
+		present bool
+	}{
+		{"a", "3", true},
+		{"b", "2", true},
+		{"c", "", false},
+	}
+	for _, d := range testdata {
+		value, ok := p.Get(d.key)
+		assert.Equal(t, d.present, ok)
+		assert.Equal(t, d.value, value)
+		assert.LogOnFailure(t, d.key)
+	}
+}
+
+func TestValidateProperty(t *testing.T) {
+	testdata := []struct {
+		key   string
+		value string
+		valid bool
+	}{
+		{"custom", "value", true},
+		{"custom", "", true},
+		{"dc:creator", "someone", true},
+		{"custom-field", "value with spaces", true},
+		{"", "value", false},
+		{" custom", "value", false},
+		{"custom ", "value", false},
+		{"cus=tom", "value", false},
+		{"cus\ntom", "value", false},
+		{"#custom", "value", false},
+		{"!custom", "value", false},
+		{"custom", " value", false},
+		{"custom", "value ", false},
+		{"custom", "multi\nline", false},
+		{"custom", "multi\rline", false},
+		// known properties are represented as typed fields
+		{propName, "x.pdf", false},
+		{propCiteKey, "key", false},
+		{FieldTitle, "Title", false},
+		{propTags0Prefix + "topic", "crypto", false},
+		{propTagsOldPrefix + "topic", "crypto", false},
+	}
+	for _, d := range testdata {
+		err := validateProperty(d.key, d.value)
+		if d.valid {
+			assert.Nil(t, err)
+		} else {
+			assert.IsError(t, errors.ErrIllegal, err)
+		}
+		assert.LogOnFailure(t, d.key+"="+d.value)
+	}
+}
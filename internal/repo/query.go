@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cobratbq/goutils/std/errors"
+)
+
+// Query selects objects by their tags. A query is an expression over terms that test membership of categories
+// and tags:
+//
+//   - `<category>/<tag>` matches objects tagged with the tag, or with any of its nested tags, e.g. `topic/crypto`
+//     or `topic/programming/go`.
+//   - `<category>/<pattern>` matches objects tagged with a tag, or with any of its nested tags, that matches the
+//     wildcard pattern, with `*`, `?` and `[…]` as in `path.Match`, e.g. `topic/crypto*` or
+//     `topic/programming/*`. `<category>/*` matches objects with any tag in the category.
+//   - `untagged:<category>` matches objects without any tag in the category.
+//
+// Terms are combined with `AND` (or `&`, or juxtaposition), `OR` (or `|`) and `NOT` (or `!`), in order of
+// decreasing precedence: `NOT`, `AND`, `OR`. Parentheses group expressions. Categories and tags are resolved
+// by key, see `sanitizeName`. Terms that contain whitespace or operator characters are quoted with `"`.
+//
+// For example: `topic/crypto AND NOT status/read`.
+type Query struct {
+	expr string
+	root queryNode
+}
+
+// ParseQuery parses a query expression, see `Query`.
+func ParseQuery(expr string) (Query, error) {
+	tokens, err := tokenizeQuery(expr)
+	if err != nil {
+		return Query{}, err
+	}
+	p := queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return Query{}, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return Query{}, queryError(t, "unexpected '"+t.text+"'")
+	}
+	return Query{expr: expr, root: root}, nil
+}
+
+// String returns the query expression.
+func (q Query) String() string {
+	return q.expr
+}
+
+// Match checks whether the tags of obj satisfy the query.
+func (q Query) Match(obj *RepoObj) bool {
+	return q.root.match(obj)
+}
+
+// Query lists the objects that satisfy the query expression, sorted by name. See `Query` for the syntax.
+func (r *Repo) Query(expr string) ([]RepoObj, error) {
+	q, err := ParseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	objects = slices.DeleteFunc(objects, func(o RepoObj) bool { return !q.Match(&o) })
+	slices.SortFunc(objects, objNameCompare)
+	return objects, nil
+}
+
+type queryNode interface {
+	match(obj *RepoObj) bool
+}
+
+type queryAnd struct {
+	left, right queryNode
+}
+
+func (n queryAnd) match(obj *RepoObj) bool {
+	return n.left.match(obj) && n.right.match(obj)
+}
+
+type queryOr struct {
+	left, right queryNode
+}
+
+func (n queryOr) match(obj *RepoObj) bool {
+	return n.left.match(obj) || n.right.match(obj)
+}
+
+type queryNot struct {
+	node queryNode
+}
+
+func (n queryNot) match(obj *RepoObj) bool {
+	return !n.node.match(obj)
+}
+
+// queryTag matches objects with a tag in category cat, for which the tag or one of its ancestors matches the
+// pattern.
+type queryTag struct {
+	cat     string
+	pattern string
+}
+
+func (n queryTag) match(obj *RepoObj) bool {
+	for _, tag := range obj.Tags[n.cat] {
+		for _, t := range append(tagAncestors(tag), tag) {
+			if ok, _ := path.Match(n.pattern, t); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queryUntagged matches objects without any tag in category cat.
+type queryUntagged struct {
+	cat string
+}
+
+func (n queryUntagged) match(obj *RepoObj) bool {
+	return len(obj.Tags[n.cat]) == 0
+}
+
+type tokenKind uint8
+
+const (
+	tokenEnd tokenKind = iota
+	tokenTerm
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func queryError(t queryToken, message string) error {
+	return errors.Context(errors.ErrIllegal, "query: "+message+" at position "+strconv.Itoa(t.pos+1))
+}
+
+// queryOperators are the characters that form tokens by themselves.
+const queryOperators = "&|!()"
+
+func tokenizeQuery(expr string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte(queryOperators, c) >= 0:
+			kind := map[byte]tokenKind{'&': tokenAnd, '|': tokenOr, '!': tokenNot, '(': tokenOpen, ')': tokenClose}[c]
+			tokens = append(tokens, queryToken{kind: kind, text: string(c), pos: i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(expr[i+1:], '"')
+			if end < 0 {
+				return nil, queryError(queryToken{pos: i}, "unterminated quote")
+			}
+			tokens = append(tokens, queryToken{kind: tokenTerm, text: expr[i+1 : i+1+end], pos: i})
+			i += end + 2
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\n\r\""+queryOperators, rune(expr[i])) {
+				i++
+			}
+			t := queryToken{kind: tokenTerm, text: expr[start:i], pos: start}
+			switch strings.ToUpper(t.text) {
+			case "AND":
+				t.kind = tokenAnd
+			case "OR":
+				t.kind = tokenOr
+			case "NOT":
+				t.kind = tokenNot
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return append(tokens, queryToken{kind: tokenEnd, text: "end of query", pos: len(expr)}), nil
+}
+
+// queryParser is a recursive-descent parser for query expressions.
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) take() queryToken {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = queryOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.take()
+		case tokenTerm, tokenNot, tokenOpen:
+			// juxtaposition implies AND
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = queryAnd{left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek().kind == tokenNot {
+		p.take()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{node: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	t := p.take()
+	switch t.kind {
+	case tokenOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.take(); c.kind != tokenClose {
+			return nil, queryError(c, "expected ')' but found '"+c.text+"'")
+		}
+		return node, nil
+	case tokenTerm:
+		return parseQueryTerm(t)
+	default:
+		return nil, queryError(t, "expected term or '(' but found '"+t.text+"'")
+	}
+}
+
+func parseQueryTerm(t queryToken) (queryNode, error) {
+	if len(t.text) > len("untagged:") && strings.EqualFold(t.text[:len("untagged:")], "untagged:") {
+		cat := sanitizeName(t.text[len("untagged:"):])
+		if !validCategoryName(cat) {
+			return nil, queryError(t, "invalid category '"+cat+"'")
+		}
+		return queryUntagged{cat: cat}, nil
+	}
+	cat, pattern, ok := strings.Cut(t.text, tagSeparator)
+	if !ok || pattern == "" {
+		return nil, queryError(t, "expected <category>/<tag> but found '"+t.text+"'")
+	}
+	cat, pattern = sanitizeName(cat), sanitizeTagPath(pattern)
+	if !validCategoryName(cat) {
+		return nil, queryError(t, "invalid category '"+cat+"'")
+	}
+	if !validTagPath(pattern) {
+		return nil, queryError(t, "invalid tag '"+pattern+"'")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, queryError(t, "invalid pattern '"+pattern+"'")
+	}
+	return queryTag{cat: cat, pattern: pattern}, nil
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"testing"
+
+	"github.com/cobratbq/goutils/std/errors"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	crypto := RepoObj{Name: "crypto.pdf", Tags: map[string][]string{"topic": {"crypto"}, "status": {"read"}}}
+	golang := RepoObj{Name: "go.pdf", Tags: map[string][]string{"topic": {"programming/go"}}}
+	rust := RepoObj{Name: "rust.pdf", Tags: map[string][]string{"topic": {"programming/rust"}, "status": {"unread"}}}
+	untagged := RepoObj{Name: "untagged.pdf"}
+	objects := []RepoObj{crypto, golang, rust, untagged}
+	testdata := []struct {
+		expr     string
+		expected []string
+	}{
+		{"topic/crypto", []string{"crypto.pdf"}},
+		{"topic/programming", []string{"go.pdf", "rust.pdf"}},
+		{"topic/programming/go", []string{"go.pdf"}},
+		{"Topic/Crypto", []string{"crypto.pdf"}},
+		// wildcards over nested tags
+		{"topic/*", []string{"crypto.pdf", "go.pdf", "rust.pdf"}},
+		{"topic/programming/*", []string{"go.pdf", "rust.pdf"}},
+		{"topic/programming/r*", []string{"rust.pdf"}},
+		{"topic/pro*", []string{"go.pdf", "rust.pdf"}},
+		{"topic/?o", nil},
+		{"topic/crypt?", []string{"crypto.pdf"}},
+		{"topic/programming/?o", []string{"go.pdf"}},
+		{"topic/[cg]*", []string{"crypto.pdf"}},
+		// untagged
+		{"untagged:status", []string{"go.pdf", "untagged.pdf"}},
+		{"untagged:topic", []string{"untagged.pdf"}},
+		{"UNTAGGED:Status", []string{"go.pdf", "untagged.pdf"}},
+		{"!untagged:status", []string{"crypto.pdf", "rust.pdf"}},
+		// operators
+		{"topic/crypto OR topic/programming/go", []string{"crypto.pdf", "go.pdf"}},
+		{"topic/crypto | topic/programming/go", []string{"crypto.pdf", "go.pdf"}},
+		{"topic/programming AND status/unread", []string{"rust.pdf"}},
+		{"topic/programming & status/unread", []string{"rust.pdf"}},
+		{"topic/programming and status/unread", []string{"rust.pdf"}},
+		{"NOT topic/programming", []string{"crypto.pdf", "untagged.pdf"}},
+		{"!topic/programming", []string{"crypto.pdf", "untagged.pdf"}},
+		{"NOT NOT topic/crypto", []string{"crypto.pdf"}},
+		// juxtaposition implies AND
+		{"topic/programming status/unread", []string{"rust.pdf"}},
+		{"topic/programming !status/unread", []string{"go.pdf"}},
+		{"topic/programming (status/unread)", []string{"rust.pdf"}},
+		{"topic/* untagged:status", []string{"go.pdf"}},
+		// precedence: NOT binds strongest, then AND, then OR
+		{"topic/crypto OR topic/programming AND status/unread", []string{"crypto.pdf", "rust.pdf"}},
+		{"topic/programming AND status/unread OR topic/crypto", []string{"crypto.pdf", "rust.pdf"}},
+		{"(topic/crypto OR topic/programming) AND status/unread", []string{"rust.pdf"}},
+		{"NOT topic/crypto AND NOT untagged:topic", []string{"go.pdf", "rust.pdf"}},
+		{"NOT (topic/crypto OR untagged:topic)", []string{"go.pdf", "rust.pdf"}},
+		{"topic/crypto status/read | topic/programming/go", []string{"crypto.pdf", "go.pdf"}},
+		// quoting
+		{`"topic/crypto"`, []string{"crypto.pdf"}},
+		{`"topic/programming/go"|"topic/crypto"`, []string{"crypto.pdf", "go.pdf"}},
+		{`"topic/programming and more"`, nil},
+		{`"topic/crypto" "status/read"`, []string{"crypto.pdf"}},
+	}
+	for _, d := range testdata {
+		q, err := ParseQuery(d.expr)
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, d.expr)
+		var matched []string
+		for i := range objects {
+			if q.Match(&objects[i]) {
+				matched = append(matched, objects[i].Name)
+			}
+		}
+		assert.SlicesEqual(t, d.expected, matched)
+		assert.LogOnFailure(t, d.expr)
+	}
+}
+
+func TestQueryQuotedTerm(t *testing.T) {
+	obj := RepoObj{Tags: map[string][]string{"topic": {"and-or"}, "reading-list": {"later"}}}
+	testdata := []string{`"topic/and or"`, `"topic/AND-OR"`, `"reading list/later"`, `topic/and-or`}
+	for _, expr := range testdata {
+		q, err := ParseQuery(expr)
+		assert.Nil(t, err)
+		assert.StopOnFailure(t, expr)
+		assert.True(t, q.Match(&obj))
+		assert.LogOnFailure(t, expr)
+	}
+}
+
+func TestParseQueryInvalid(t *testing.T) {
+	testdata := []string{
+		"",
+		"topic",
+		"topic/",
+		"/crypto",
+		"untagged:",
+		"topic/crypto AND",
+		"OR topic/crypto",
+		"NOT",
+		"(topic/crypto",
+		"topic/crypto)",
+		"()",
+		`"topic/crypto`,
+		"topic/[crypto",
+		"titles/crypto",
+		"untagged:repo",
+	}
+	for _, expr := range testdata {
+		_, err := ParseQuery(expr)
+		assert.IsError(t, errors.ErrIllegal, err)
+		assert.LogOnFailure(t, expr)
+	}
+}
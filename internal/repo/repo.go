@@ -9,63 +9,89 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/cobratbq/goutils/assert"
-	bufio_ "github.com/cobratbq/goutils/std/bufio"
-	"github.com/cobratbq/goutils/std/builtin"
 	"github.com/cobratbq/goutils/std/builtin/maps"
 	"github.com/cobratbq/goutils/std/errors"
-	hash_ "github.com/cobratbq/goutils/std/hash"
 	io_ "github.com/cobratbq/goutils/std/io"
 	"github.com/cobratbq/goutils/std/log"
 	os_ "github.com/cobratbq/goutils/std/os"
-	strings_ "github.com/cobratbq/goutils/std/strings"
-	"golang.org/x/crypto/blake2b"
 )
 
 const (
-	version              = "0"
+	// version is the current format version of properties-files.
+	version              = "1"
 	subdirRepo           = "repo"
 	subdirTitles         = "titles"
 	tempFilePrefix       = "temp--"
 	repoPropertiesSuffix = ".properties"
 	propVersion          = "version"
 	propHash             = "hash"
-	propHashspecPrefix   = "blake2b:"
-	propName             = "name"
-	propTagsOldPrefix    = "tags."
-	propTags0Prefix      = "tags;"
+	// propHashspecSeparator separates the hash algorithm from the checksum in the hashspec.
+	propHashspecSeparator = ":"
+	propName              = "name"
+	propAliases           = "aliases"
+	propCiteKey           = "citekey"
+	propTagsOldPrefix     = "tags."
+	propTags0Prefix       = "tags;"
+	// propTagsOldSeparator separates tags in the value of (legacy) 'tags.'-prefixed properties.
+	propTagsOldSeparator = ','
+	// propTagsSeparator separates tags in the value of 'tags;'-prefixed properties. As '/' cannot be part of
+	// a tag (directory) name, the separator is unambiguous.
+	propTagsSeparator = '/'
 )
 
 var propTags0IllegalChars = []byte{0, '/'}
 
-func Hash(location string) ([64]byte, error) {
-	if hash, err := hash_.HashFile(builtin.Expect(blake2b.New512(nil)), location); err == nil {
-		return [64]byte(hash), nil
-	} else {
-		return [64]byte{}, errors.Context(err, "hashing content at '"+location+"'")
-	}
-}
-
 func isStandardDir(name string) bool {
 	return name == subdirRepo || name == subdirTitles
 }
 
+// Tag is a tag within a category. Key is the sanitized key of the tag, see `sanitizeName`, and Title is the
+// name of its tag-directory, unchanged from the file system representation. Tags may be nested, in which
+// case Key is the path of keys of the tag within the category, e.g. `programming/go`.
 type Tag struct {
 	Key   string
 	Title string
+	// Path is the path of the tag-directory relative to the category-directory.
+	Path string
 }
 
+// Parent returns the key of the parent tag, or an empty string for a top-level tag.
+func (t Tag) Parent() string {
+	return parentTag(t.Key)
+}
+
+// Repo is a document repository. Repo is safe for concurrent use. Operations are coordinated by the
+// repository lock, see `LockMode`.
 type Repo struct {
 	location string
-	cats     map[string][]Tag
+	config   Config
+	// mu guards cats and schema, and coordinates operations within the process.
+	mu     sync.RWMutex
+	cats   map[string]category
+	schema Schema
+	// idxmu guards index, which is maintained by operations that hold the lock in shared mode.
+	idxmu sync.RWMutex
+	index *tagIndex
+	// lockTimeout is the duration to wait for the repository lock.
+	lockTimeout atomic.Int64
+	// lockmu guards the state of the advisory file-lock.
+	lockmu    sync.Mutex
+	lockf     *os.File
+	lockMode  LockMode
+	lockCount uint
 }
 
-func (r *Repo) repofilepath(path string) string {
-	if path == "" || path == "." {
+// repofilepath returns the path of an object or properties-file with the specified name, according to the
+// layout of the repository. An empty name returns the path of the object-repository directory.
+func (r *Repo) repofilepath(name string) string {
+	if name == "" || name == "." {
 		return filepath.Join(r.location, subdirRepo)
 	}
-	return filepath.Join(r.location, subdirRepo, path)
+	return filepath.Join(r.location, subdirRepo, shardpath(r.config.Layout, name))
 }
 
 func (r *Repo) temprepofile() (*os.File, string, error) {
@@ -78,21 +104,74 @@ func (r *Repo) temprepofile() (*os.File, string, error) {
 	return tempf, tempf.Name(), nil
 }
 
+// category is the index of a category: the name of its directory and its (nested) tags.
+type category struct {
+	dir  string
+	tags []Tag
+	// paths maps the key of each tag to the path of its tag-directory.
+	paths map[string]string
+}
+
+// tagdir returns the path of the tag-directory of tag, relative to the category-directory. Tags are resolved
+// by key, such that existing directories are found regardless of capitalization and formatting of tag.
+// Directories that do not exist yet are named as specified.
+func (c *category) tagdir(tag string) string {
+	var path string
+	names := strings.Split(tag, tagSeparator)
+	for i, name := range names {
+		if p, ok := c.paths[sanitizeTagPath(strings.Join(names[:i+1], tagSeparator))]; ok {
+			path = p
+		} else {
+			path = filepath.Join(path, name)
+		}
+	}
+	return path
+}
+
 // TODO consider renaming 'titles' to 'archive' or 'all' or something, to indicate that it lists all documents
+// listOptions lists the (nested) tags of the category at location, depth-first, such that each tag directly
+// follows its parent. Of tag-directories that resolve to the same key, only the first is listed, see
+// `findCollisions`.
 func listOptions(location string) ([]Tag, error) {
-	if entries, err := os.ReadDir(location); err != nil {
-		return nil, errors.Context(err, "directory missing for tag-group: "+location)
-	} else {
-		index := []Tag{}
+	index := []Tag{}
+	seen := map[string]struct{}{}
+	var walk func(parent Tag) error
+	walk = func(parent Tag) error {
+		entries, err := os.ReadDir(filepath.Join(location, parent.Path))
+		if err != nil {
+			return err
+		}
 		for _, e := range entries {
-			index = append(index, Tag{Key: e.Name(), Title: e.Name()})
+			if !e.IsDir() {
+				continue
+			}
+			tag := Tag{Key: sanitizeName(e.Name()), Title: e.Name(), Path: e.Name()}
+			if parent.Path != "" {
+				tag.Key = parent.Key + tagSeparator + tag.Key
+				tag.Path = filepath.Join(parent.Path, tag.Path)
+			}
+			if _, ok := seen[tag.Key]; ok {
+				log.Traceln("Skipping tag-directory with duplicate key:", tag.Path)
+				continue
+			}
+			seen[tag.Key] = struct{}{}
+			index = append(index, tag)
+			if err := walk(tag); err != nil {
+				return err
+			}
 		}
-		return index, nil
+		return nil
+	}
+	if err := walk(Tag{}); err != nil {
+		return nil, errors.Context(err, "directory missing for tag-group: "+location)
 	}
+	return index, nil
 }
 
-func readTagEntries(location string) (map[string][]Tag, error) {
-	index := map[string][]Tag{}
+// readTagEntries reads the categories and their tags, indexed by key. Of category-directories that resolve to
+// the same key, only the first is indexed, see `findCollisions`.
+func readTagEntries(location string) (map[string]category, error) {
+	index := map[string]category{}
 	entries, err := os.ReadDir(location)
 	if err != nil {
 		return index, errors.Context(err, "open repository root-directory")
@@ -101,15 +180,72 @@ func readTagEntries(location string) (map[string][]Tag, error) {
 		if !e.IsDir() || isStandardDir(e.Name()) || strings.HasPrefix(e.Name(), ".") {
 			continue
 		}
-		index[e.Name()] = builtin.Expect(listOptions(filepath.Join(location, e.Name())))
+		key := sanitizeName(e.Name())
+		if _, ok := index[key]; ok {
+			log.Traceln("Skipping category-directory with duplicate key:", e.Name())
+			continue
+		}
+		tags, err := listOptions(filepath.Join(location, e.Name()))
+		if err != nil {
+			return index, err
+		}
+		paths := make(map[string]string, len(tags))
+		for _, t := range tags {
+			paths[t.Key] = t.Path
+		}
+		index[key] = category{dir: e.Name(), tags: tags, paths: paths}
 	}
 	return index, nil
 }
 
-func OpenRepository(location string) (Repo, error) {
+// tagdir returns the path of the tag-directory of tag in category cat, relative to the repository root, see
+// `category.tagdir`. An empty tag returns the path of the category-directory. The caller is expected to hold
+// the mutex.
+func (r *Repo) tagdir(cat, tag string) string {
+	return tagdir(r.cats, cat, tag)
+}
+
+func tagdir(index map[string]category, cat, tag string) string {
+	c, ok := index[sanitizeName(cat)]
+	if !ok {
+		c.dir = cat
+	}
+	if tag == "" {
+		return c.dir
+	}
+	return filepath.Join(c.dir, c.tagdir(tag))
+}
+
+// OpenRepository opens the repository at location. The directory must be marked as repository, see
+// `InitRepository` and `AdoptRepository`. A repository in an older format must be migrated first, see
+// `Migrate`.
+func OpenRepository(location string) (*Repo, error) {
+	r, err := openRepository(location)
+	if err != nil {
+		return nil, err
+	}
+	if r.config.Version != configVersion {
+		return nil, errors.Context(ErrMigrationRequired, "repository format version "+r.config.Version+
+			", current version "+configVersion)
+	}
+	return r, nil
+}
+
+// openRepository opens the repository at location, regardless of its format version.
+func openRepository(location string) (*Repo, error) {
 	if !os_.ExistsIsDirectory(location) {
-		return Repo{}, errors.ErrIllegal
+		return nil, errors.ErrIllegal
+	}
+	config, err := readConfig(location)
+	if err != nil {
+		return nil, errors.Context(err, "reading repository configuration")
 	}
+	return openRepositoryConfig(location, config)
+}
+
+// openRepositoryConfig opens the repository at location with the specified configuration, instead of the
+// configuration as recorded in the repository marker-file.
+func openRepositoryConfig(location string, config Config) (*Repo, error) {
 	if subdir := filepath.Join(location, subdirRepo); !os_.ExistsIsDirectory(subdir) {
 		log.Infoln("Empty repository. Creating directory 'repo'…")
 		os.Mkdir(subdir, 0o700)
@@ -120,21 +256,50 @@ func OpenRepository(location string) (Repo, error) {
 	}
 	index, err := readTagEntries(location)
 	if err != nil {
-		return Repo{}, errors.Context(err, "reading tags from repository")
+		return nil, errors.Context(err, "reading tags from repository")
 	}
 	log.Traceln("Category-index:", index)
-	return Repo{location: location, cats: index}, nil
+	schema, err := readSchema(location)
+	if err != nil {
+		return nil, errors.Context(err, "reading schema of repository")
+	}
+	return &Repo{location: location, config: config, cats: index, schema: schema, index: buildTagIndex(location, index)}, nil
 }
 
+// Reload rereads the categories and tags from the file system, rebuilds the tag-index and rereads the schema.
+// Use Reload to pick up changes made outside of this instance, e.g. by another process.
 func (r *Repo) Reload() error {
+	unlock, err := r.lockProcess(LockExclusive, r.lockDeadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return r.reload()
+}
+
+// reload rereads the categories and tags from the file system, rebuilds the tag-index and rereads the
+// schema. The caller is expected to hold the mutex exclusively.
+func (r *Repo) reload() error {
 	index, err := readTagEntries(r.location)
-	if err == nil {
-		r.cats = index
+	if err != nil {
+		return err
 	}
-	return err
+	schema, err := readSchema(r.location)
+	if err != nil {
+		return err
+	}
+	r.cats, r.schema = index, schema
+	tags := buildTagIndex(r.location, index)
+	r.idxmu.Lock()
+	r.index = tags
+	r.idxmu.Unlock()
+	return nil
 }
 
+// Categories returns the (sorted) keys of the categories.
 func (r *Repo) Categories() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	keys := maps.ExtractKeys(r.cats)
 	slices.Sort(keys)
 	return keys
@@ -144,258 +309,184 @@ func (r *Repo) Location() string {
 	return r.location
 }
 
-// Tags returns list of Tags (lower-cased identifier and a title, unchanged from the file system representation).
+// Config returns the repository configuration.
+func (r *Repo) Config() Config {
+	return r.config
+}
+
+// Schema returns the schema that defines the custom fields of repository objects.
+func (r *Repo) Schema() Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.schema
+}
+
+// CategoryTitle returns the title of the category, i.e. the name of its directory, unchanged from the file
+// system representation.
+func (r *Repo) CategoryTitle(category string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if c, ok := r.cats[sanitizeName(category)]; ok {
+		return c.dir
+	}
+	return category
+}
+
+// Tags returns list of Tags (sanitized key and a title, unchanged from the file system representation).
 func (r *Repo) Tags(category string) []Tag {
-	if index, ok := r.cats[category]; !ok {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if c, ok := r.cats[sanitizeName(category)]; !ok {
 		return nil
 	} else {
-		return index
+		return c.tags
 	}
 }
 
-func (r *Repo) checkTagsForObject(id, name string) error {
-	entries, err := os.ReadDir(r.location)
-	if err != nil {
-		return errors.Context(err, "failed to open root repository directory for tags processing")
-	}
-	for _, e := range entries {
-		if !e.IsDir() || isStandardDir(e.Name()) || strings.HasPrefix(e.Name(), ".") {
-			continue
+func (r *Repo) writeProperties(obj *RepoObj) error {
+	var buffer = []byte(propVersion + "=" + version + "\n" + propHash + "=" + obj.Algorithm + propHashspecSeparator + obj.Id + "\n" + propName + "=" + obj.Name + "\n")
+	if len(obj.Aliases) > 0 {
+		buffer = append(buffer, propAliases+"="+strings.Join(obj.Aliases, string(propTagsSeparator))+"\n"...)
+	}
+	if obj.CiteKey != "" {
+		buffer = append(buffer, propCiteKey+"="+obj.CiteKey+"\n"...)
+	}
+	buffer = writeMetadata(buffer, &obj.Meta)
+	for _, cat := range obj.Categories() {
+		// Nested tags are grouped by parent, with the parent path as part of the key, e.g.
+		// 'tags;topic/programming=go/rust'.
+		groups := map[string][]string{}
+		for _, tag := range obj.Tags[cat] {
+			groups[parentTag(tag)] = append(groups[parentTag(tag)], tagName(tag))
 		}
-		tagdirs, err := os.ReadDir(filepath.Join(r.location, e.Name()))
-		if err != nil {
-			log.Warnln("Failed to open tag-directory for tag-group", e.Name())
-			continue
-		}
-		for _, t := range tagdirs {
-			if !t.IsDir() {
-				continue
-			}
-			path := filepath.Join(r.location, e.Name(), t.Name(), name)
-			relobjpath := filepath.Join("..", "..", subdirRepo, id)
-			if info, err := os.Lstat(path); err != nil {
-				continue
-			} else if info.Mode()&os.ModeSymlink == 0 {
-				log.Warnln("Foreign object at", path, ". Not making changes.")
-				continue
-			} else if linkpath := builtin.Expect(os.Readlink(path)); linkpath != relobjpath {
-				log.Traceln("Tag symlink points to different repository-object. This will be fixed in different step of the checking-process.")
-				continue
+		parents := maps.ExtractKeys(groups)
+		slices.Sort(parents)
+		for _, parent := range parents {
+			key := cat
+			if parent != "" {
+				key += tagSeparator + parent
 			}
+			buffer = append(buffer, propTags0Prefix+key+"="+strings.Join(groups[parent], string(propTagsSeparator))+"\n"...)
 		}
 	}
-	return nil
+	buffer = obj.Props.appendProperties(nil, buffer)
+	return writeFileAtomic(r.repofilepath(obj.Id)+repoPropertiesSuffix, buffer, 0o600)
 }
 
-func (r *Repo) checkBadTags() error {
-	entries, err := os.ReadDir(r.location)
-	if err != nil {
-		return errors.Context(err, "failed to open repository root-directory for tags processing")
-	}
-	for _, e := range entries {
-		if !e.IsDir() || isStandardDir(e.Name()) || strings.HasPrefix(e.Name(), ".") {
-			continue
-		}
-		log.Traceln("Processing tag-category '" + e.Name() + "'…")
-		tagdirs, err := os.ReadDir(filepath.Join(r.location, e.Name()))
-		if err != nil {
-			log.Warnln("Failed to open tag-directory for tag-group", e.Name())
-			continue
-		}
-		for _, t := range tagdirs {
-			if !t.IsDir() {
-				continue
-			}
-			log.Traceln("Processing tag '" + t.Name() + "' in category '" + e.Name() + "'…")
-			links, err := os.ReadDir(filepath.Join(r.location, e.Name(), t.Name()))
-			if err != nil {
-				log.Warnln("Failed to read files in tag-directory:", err.Error())
-				continue
-			}
-			for _, link := range links {
-				log.Traceln("Processing symlink '" + link.Name() + "'…")
-				linkpath := filepath.Join(r.location, e.Name(), t.Name(), link.Name())
-				if _, err := os.Stat(linkpath); err == nil {
-					relobjpath, err := os.Readlink(linkpath)
-					if err != nil {
-						log.Warnln("Failed to read repo-object path from symlink:", err.Error())
-						continue
-					}
-					repoobj, err := r.OpenObject(filepath.Base(relobjpath))
-					if err != nil {
-						log.Warnln("Failed to open repo-object:", err.Error())
-						continue
-					}
-					if link.Name() != repoobj.Name {
-						expectedpath := filepath.Join(r.location, e.Name(), t.Name(), repoobj.Name)
-						if !os_.Exists(expectedpath) {
-							os.Symlink(filepath.Join("..", "..", subdirRepo, repoobj.Id), expectedpath)
-							log.Debugln("Created symlink with correct name at:", expectedpath)
-						} else {
-							log.Traceln("Symlink with correct name already exists.")
-						}
-						// Symlink with (most likely) outdated name. Can be removed, as we would already
-						// (re)create the missing symlink if we wouldn't find it at the expected name.
-						if err = os.Remove(linkpath); err == nil {
-							log.Debugln("Removed symlink with incorrect name at:", linkpath)
-						} else {
-							log.Warnln("Failed to remove symlink with incorrect name at:", linkpath)
-						}
-					}
-				} else {
-					// Remove broken symlink.
-					if err := os.Remove(linkpath); err == nil {
-						log.Debugln("Removed broken symlink at:", linkpath)
-					} else {
-						log.Warnln("Failed to remove broken symlink at:", linkpath)
-					}
-				}
-			}
-		}
-	}
-	return nil
+type RepoObj struct {
+	Id string
+	// Algorithm is the hash algorithm by which the object is identified.
+	Algorithm string
+	Name      string
+	// Aliases contains alternative names, e.g. the names under which the object was imported again.
+	Aliases []string
+	// CiteKey is the citation key, as recorded when the object was first exported, see `CitationKeys`.
+	CiteKey string
+	// Meta contains the bibliographic metadata.
+	Meta Metadata
+	// Tags contains, per category, the (sorted) tags assigned to the object. Nested tags are represented by
+	// their path, e.g. `programming/go`.
+	Tags map[string][]string
+	// Props contains any properties that are not otherwise represented, in order of appearance.
+	Props Properties
 }
 
-// FIXME see if we can reliably determine that repo-directory truly is a repository before making changes.
-func (r *Repo) Check() error {
-	var entries []os.DirEntry
-	var err error
+// Clone returns a copy of the object, which can be modified independently of the original.
+func (o *RepoObj) Clone() RepoObj {
+	c := *o
+	c.Aliases = slices.Clone(o.Aliases)
+	c.Meta.Authors = slices.Clone(o.Meta.Authors)
+	c.Tags = make(map[string][]string, len(o.Tags))
+	for cat, tags := range o.Tags {
+		c.Tags[cat] = slices.Clone(tags)
+	}
+	c.Props = Properties{entries: slices.Clone(o.Props.entries)}
+	return c
+}
 
-	log.Infoln("Checking repository…")
-	defer log.Infoln("Finished repository check.")
+// Categories returns the (sorted) categories for which the object has tags assigned.
+func (o *RepoObj) Categories() []string {
+	cats := maps.ExtractKeys(o.Tags)
+	slices.Sort(cats)
+	return cats
+}
 
-	if entries, err = os.ReadDir(r.repofilepath("")); err != nil {
-		return errors.Context(err, "failed to open object-repository directory")
-	}
-	for _, e := range entries {
-		log.Traceln("Processing repo-entry…", e.Name())
-		// Any non-regular file-system object is a foreign entity.
-		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
-			log.Warnln(e.Name(), ": is a foreign object.")
-			continue
-		}
-		// Check if properties-file has a corresponding repository object.
-		if strings.HasSuffix(e.Name(), repoPropertiesSuffix) {
-			// properties-files are processed in conjuction with the corresponding binary file.
-			if info, err := os.Stat(r.repofilepath(strings.TrimSuffix(e.Name(), repoPropertiesSuffix))); err != nil {
-				log.Infoln("Encountered properties-file without corresponding object-binary:", e.Name())
-				if err := os.Remove(r.repofilepath(e.Name())); err != nil {
-					log.Warnln("Failed to remove orphaned properties-file '"+e.Name()+"' from repository:", err.Error())
-				} else {
-					log.Debugln("Removed orphaned properties-file:", e.Name())
-				}
-			} else if info.Mode()&os.ModeType != 0 {
-				log.Warnln("Corresponding file-system object is not a regular file:", info.Name())
-			}
-			continue
-		}
-		// Remove abandoned temporary repository objects.
-		if strings.HasPrefix(e.Name(), tempFilePrefix) {
-			if err = os.Remove(r.repofilepath(e.Name())); err != nil {
-				log.Warnln("Failed to remove old temporary file '"+e.Name()+"':", err.Error())
-			} else {
-				log.Debugln("Removed temporary file:", e.Name())
-			}
-			continue
-		}
-		// Comparing file content checksum with binary-object name.
-		if checksum, err := hash_.HashFile(builtin.Expect(blake2b.New512(nil)), r.repofilepath(e.Name())); err != nil {
-			log.Warnln("Failed to hash repo-object:", hex.EncodeToString(checksum))
-		} else if e.Name() != hex.EncodeToString(checksum) {
-			log.Warnln("Repo-object '" + e.Name() + "': checksum does not match. Possible corruption. (checksum: " + hex.EncodeToString(checksum) + ")")
-		}
-		// Checking file-permissions for writability.
-		if info, err := os.Stat(r.repofilepath(e.Name())); err == nil && info.Mode()&0o222 != 0 {
-			log.Warnln(e.Name(), ": is writable, which should not be the case for (immutable) repository-objects.")
-		}
-		// Checking characteristics of file properties.
-		if info, err := os.Stat(r.repofilepath(e.Name() + repoPropertiesSuffix)); err != nil {
-			log.Warnln(e.Name()+repoPropertiesSuffix, ": properties-file is missing.")
-		} else if info.Mode()&os.ModeType != 0 {
-			log.Warnln(e.Name()+repoPropertiesSuffix, ": properties-file is not a regular file.")
-		} else if o, err := r.OpenObject(e.Name()); err != nil {
-			log.Warnln(e.Name(), ": failed to parse properties: ", err.Error())
-		} else {
-			if o.Id != e.Name() {
-				log.Warnln(e.Name(), ": invalid properties", e.Name(), o.Id)
-			}
-			titlepath := filepath.Join(r.location, subdirTitles, o.Name)
-			if info, err := os.Lstat(titlepath); err != nil {
-				// Create symlink when one does not exist under the correct name as stated in the properties.
-				// Next we will remove symlinks that refer to repo-objects that have a different name-prop.
-				if err := os.Symlink(filepath.Join("..", subdirRepo, e.Name()), titlepath); err != nil {
-					log.Warnln(e.Name(), ": failed to create symlink at:", titlepath, err.Error())
-				} else {
-					log.Debugln(e.Name(), ": missing symlink in document titles recreated at:", titlepath)
-				}
-			} else if info.Mode()&os.ModeSymlink == 0 {
-				log.Warnln(info.Name(), ": a foreign file-system object was found where a symlink to a repo-object was expected.")
-			} else if targetpath, err := os.Readlink(titlepath); err == nil && filepath.Base(targetpath) != e.Name() {
-				log.Warnln("Symlink does not point to expected repo-object. Duplicate names are in use:", targetpath)
-			}
-			// Verify symlinks for tags that are expected for this specific object.
-			if err := r.checkTagsForObject(o.Id, o.Name); err != nil {
-				log.Warnln("Failure during tags processing:", err.Error())
-			}
-		}
-	}
+// HasTag checks whether tag in category is recorded for the object.
+func (o *RepoObj) HasTag(cat, tag string) bool {
+	return slices.Contains(o.Tags[cat], tag)
+}
 
-	if entries, err = os.ReadDir(filepath.Join(r.location, subdirTitles)); err != nil {
-		return errors.Context(err, "failed to open directory with titles links")
+// addTag records tag in category. Returns true if the tag was not yet present.
+func (o *RepoObj) addTag(cat, tag string) bool {
+	if o.HasTag(cat, tag) {
+		return false
 	}
-	for _, e := range entries {
-		log.Traceln("Processing titles-entry…", e.Name())
-		path := filepath.Join(r.location, subdirTitles, e.Name())
-		if targetpath, err := os.Readlink(path); err != nil {
-			log.Warnln(e.Name(), ": failed to query symlink without error:", err.Error())
-		} else if obj, err := r.OpenObject(filepath.Base(targetpath)); err != nil {
-			// TODO should I be checking that linkpath has characteristics of repo-object before drawing conclusions?
-			log.Traceln("titles symlink does not correctly link to repo-object. Deleting…")
-			if err := os.Remove(path); err != nil {
-				log.Warnln("Failed to delete broken symlink in titles:", err.Error())
-				continue
-			}
-			log.Debugln("Broken symlink in titles successfully removed.", path)
-		} else if obj.Name != e.Name() {
-			log.Traceln("Titles document name does not match with 'name' property. Removing…")
-			// Previously, we created symlinks when they don't exist at expected name. Now we remove existing
-			// symlinks which refer to repo-objects with a different name.
-			if err := os.Remove(path); err != nil {
-				log.Warnln(e.Name(), ": failed to rename object to proper name:", err.Error())
-				continue
-			}
-			log.Debugln("Titles symlink does not have the correct document name. Removed.")
-		}
+	if o.Tags == nil {
+		o.Tags = map[string][]string{}
 	}
-
-	if err := r.checkBadTags(); err != nil {
-		log.Warnln("Result of checkBrokenTags:", err.Error())
-	}
-
-	// TODO count errors and report back
-	return nil
+	o.Tags[cat] = append(o.Tags[cat], tag)
+	slices.Sort(o.Tags[cat])
+	return true
 }
 
-func (r *Repo) writeProperties(objname, name string) error {
-	var buffer = []byte(propVersion + "=" + version + "\n" + propHash + "=" + propHashspecPrefix + objname + "\n" + propName + "=" + name + "\n")
-	return os.WriteFile(r.repofilepath(objname)+repoPropertiesSuffix, buffer, 0o600)
-}
-
-type RepoObj struct {
-	Id   string
-	Name string
+// removeTag removes tag in category. Returns true if the tag was present.
+func (o *RepoObj) removeTag(cat, tag string) bool {
+	idx := slices.Index(o.Tags[cat], tag)
+	if idx < 0 {
+		return false
+	}
+	o.Tags[cat] = slices.Delete(o.Tags[cat], idx, idx+1)
+	if len(o.Tags[cat]) == 0 {
+		delete(o.Tags, cat)
+	}
+	return true
 }
 
+// Tagged checks whether obj is tagged with tag in category cat. Categories and tags are resolved by key,
+// therefore may be specified in any capitalization and formatting, see `sanitizeName`. The result is
+// answered from the in-memory index, see `ObjectTags`.
 func (r *Repo) Tagged(cat, tag string, obj *RepoObj) bool {
-	cat = assert.None(filepath.Base(cat), "", ".", "..", subdirRepo, subdirTitles)
-	tag = assert.None(filepath.Base(tag), "", ".", "..")
-	return os_.ExistsIsSymlink(filepath.Join(r.location, cat, tag, obj.Name))
+	cat = assert.None(sanitizeName(filepath.Base(cat)), "", ".", "..", subdirRepo, subdirTitles)
+	tag = sanitizeTagPath(tag)
+	assert.True(validTagPath(tag))
+	r.idxmu.RLock()
+	defer r.idxmu.RUnlock()
+	return slices.Contains(r.index.objects[obj.Id][cat], tag)
 }
 
+// Tag tags obj with tag in category cat. A nested tag is specified by its path, e.g. `programming/go`. If the
+// repository is configured to imply ancestors, obj is tagged with the ancestors of tag as well. Categories
+// and tags are resolved by key, see `sanitizeName`.
 func (r *Repo) Tag(cat, tag string, obj *RepoObj) error {
-	cat = assert.None(filepath.Base(cat), "", ".", "..", subdirRepo, subdirTitles)
-	tag = assert.None(filepath.Base(tag), "", ".", "..")
-	path := filepath.Join(r.location, cat, tag, obj.Name)
+	cat = assert.None(sanitizeName(filepath.Base(cat)), "", ".", "..", subdirRepo, subdirTitles)
+	tag = sanitizeTagPath(tag)
+	assert.True(validTagPath(tag))
+	unlock, err := r.lock(LockShared)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tags := []string{tag}
+	if r.config.ImplyAncestors {
+		tags = append(tagAncestors(tag), tag)
+	}
+	var changed bool
+	for _, t := range tags {
+		if err := r.linkTag(cat, t, obj); err != nil {
+			// Record the ancestors that were tagged successfully.
+			if rerr := r.recordTags(obj, changed); rerr != nil {
+				log.Warnln("Failed to record tags:", rerr.Error())
+			}
+			return err
+		}
+		changed = obj.addTag(cat, t) || changed
+	}
+	return r.recordTags(obj, changed)
+}
+
+// linkTag creates the tag-symlink for obj, if it does not exist yet.
+func (r *Repo) linkTag(cat, tag string, obj *RepoObj) error {
+	path := filepath.Join(r.location, r.tagdir(cat, tag), obj.Name)
 	log.Traceln("Tagging path:", path)
 	if info, err := os.Lstat(path); err != nil {
 		// continue with symlinking
@@ -406,23 +497,33 @@ func (r *Repo) Tag(cat, tag string, obj *RepoObj) error {
 		log.Traceln("Symlink already exists at tag location:", path)
 		return nil
 	}
-	if err := os.Symlink(filepath.Join("..", "..", subdirRepo, obj.Id), path); err != nil {
+	if err := os.Symlink(r.linktarget(tagdepth(tag), obj.Id), path); err != nil {
 		log.Warnln("Failed to create missing symlink:", path, err.Error())
 		return errors.Context(err, "create symlink at "+path)
 	}
+	r.idxmu.Lock()
+	r.index.add(cat, tag, obj.Id)
+	r.idxmu.Unlock()
 	log.Traceln("Created symlink for tagged object at:", path)
 	return nil
 }
 
+// Untag removes tag in category cat from obj. Categories and tags are resolved by key, see `sanitizeName`.
 func (r *Repo) Untag(cat, tag string, obj *RepoObj) error {
-	cat = assert.None(filepath.Base(cat), "", ".", "..", subdirRepo, subdirTitles)
-	tag = assert.None(filepath.Base(tag), "", ".", "..")
-	path := filepath.Join(r.location, cat, tag, obj.Name)
+	cat = assert.None(sanitizeName(filepath.Base(cat)), "", ".", "..", subdirRepo, subdirTitles)
+	tag = sanitizeTagPath(tag)
+	assert.True(validTagPath(tag))
+	unlock, err := r.lock(LockShared)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	path := filepath.Join(r.location, r.tagdir(cat, tag), obj.Name)
 	log.Traceln("Untagging path:", path)
-	expected := filepath.Join("..", "..", subdirRepo, obj.Id)
+	expected := r.linktarget(tagdepth(tag), obj.Id)
 	if info, err := os.Lstat(path); err != nil {
 		log.Traceln("Symlink for untagged object does not exist at:", path)
-		return nil
+		return r.recordTags(obj, obj.removeTag(cat, tag))
 	} else if info.Mode()&os.ModeSymlink == 0 {
 		log.Warnln("Entry for untagged object is not a symlink:", path)
 		return errors.Context(errors.ErrFailure, "not a symlink")
@@ -433,40 +534,110 @@ func (r *Repo) Untag(cat, tag string, obj *RepoObj) error {
 		log.Warnln("Failed to remove symlink:", path, err.Error())
 		return errors.Context(err, "remove symlink at "+path)
 	}
+	r.idxmu.Lock()
+	r.index.remove(cat, tag, obj.Id)
+	r.idxmu.Unlock()
 	log.Traceln("Removed symlink for untagged object at:", path)
+	return r.recordTags(obj, obj.removeTag(cat, tag))
+}
+
+// recordTags persists the tags of obj in its properties, if changed.
+func (r *Repo) recordTags(obj *RepoObj, changed bool) error {
+	if !changed {
+		return nil
+	}
+	if err := r.writeProperties(obj); err != nil {
+		return errors.Context(err, "failed to record tags in properties of "+obj.Id)
+	}
 	return nil
 }
 
-// TODO consider what to do when freshly written object already has '.properties' file. This likely means duplicate import, meaning that present properties may very well be better than starting fresh.
-func (r *Repo) Acquire(reader io.Reader, name string) (RepoObj, error) {
+// Acquire acquires the content from reader into the repository as a new object with the specified name.
+// If the content is already present in the repository, the existing object and its properties are kept, and
+// name is recorded as alias if it differs from the existing name. The returned boolean indicates that the
+// content was already present.
+func (r *Repo) Acquire(reader io.Reader, name string) (RepoObj, bool, error) {
 	log.Traceln("Acquiring new document into repository…")
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return RepoObj{}, false, err
+	}
+	defer unlock()
 	tempf, tempfname, err := r.temprepofile()
 	if err != nil {
-		return RepoObj{}, errors.Context(err, "failed to create temporary file for storing content in repo")
+		return RepoObj{}, false, errors.Context(err, "failed to create temporary file for storing content in repo")
 	}
 	defer io_.CloseLogged(tempf, "Failed to gracefully close temporary file")
 	log.Traceln("Tempf:", tempfname)
-	fhash := builtin.Expect(blake2b.New512(nil))
+	fhash, err := newHash(r.config.Hash)
+	if err != nil {
+		return RepoObj{}, false, err
+	}
 	if _, err := io.Copy(io.MultiWriter(tempf, fhash), reader); err != nil {
-		return RepoObj{}, errors.Context(err, "error while copying contents into repository")
+		return RepoObj{}, false, errors.Context(err, "error while copying contents into repository")
 	}
 	checksumhex := hex.EncodeToString(fhash.Sum(nil))
 	log.Traceln("checksum:", checksumhex)
-	if err := os.Chmod(tempfname, 0o400); err != nil {
+	if os_.ExistsFile(r.repofilepath(checksumhex)) {
+		if err := os.Remove(tempfname); err != nil {
+			log.Warnln("Failed to remove temporary file of duplicate content. Next check, it will be removed:", err.Error())
+		}
+		obj, err := r.mergeDuplicate(checksumhex, name)
+		return obj, true, err
+	}
+	if err := tempf.Chmod(0o400); err != nil {
 		log.Warnln("Failed to make new repository object read-only:", err.Error())
 	}
+	if err := tempf.Sync(); err != nil {
+		return RepoObj{}, false, errors.Context(err, "failed to synchronize new repo-object to storage")
+	}
+	if err := os.MkdirAll(filepath.Dir(r.repofilepath(checksumhex)), 0o700); err != nil {
+		return RepoObj{}, false, errors.Context(err, "failed to create directory for repo-object")
+	}
 	if err := os.Rename(tempfname, r.repofilepath(checksumhex)); err != nil {
-		return RepoObj{}, errors.Context(err, "failed to move temporary file '"+tempfname+"' to definite repo-object location '"+checksumhex+"'")
+		return RepoObj{}, false, errors.Context(err, "failed to move temporary file '"+tempfname+"' to definite repo-object location '"+checksumhex+"'")
 	}
-	if err := r.writeProperties(checksumhex, name); err != nil {
-		return RepoObj{}, errors.Context(err, "failed to write properties-file")
+	// Writing the properties-file atomically, synchronizes the 'repo' directory, which includes the renamed
+	// repo-object. Upon success, both object and properties are durable.
+	if err := r.writeProperties(&RepoObj{Id: checksumhex, Algorithm: r.config.Hash, Name: name}); err != nil {
+		return RepoObj{}, false, errors.Context(err, "failed to write properties-file")
 	}
 	log.Traceln("Completed acquisition. (object: " + checksumhex + ")")
-	obj, err := r.OpenObject(checksumhex)
-	return obj, err
+	obj, err := r.openObject(checksumhex)
+	return obj, false, err
+}
+
+// mergeDuplicate merges the properties of a repeated acquisition into the properties of the existing object.
+// The existing properties are kept, the name of the repeated acquisition is recorded as alias.
+func (r *Repo) mergeDuplicate(id, name string) (RepoObj, error) {
+	if !os_.ExistsFile(r.repofilepath(id) + repoPropertiesSuffix) {
+		log.Infoln("Content already present, but properties are missing. Writing new properties. (object: " + id + ")")
+		if err := r.writeProperties(&RepoObj{Id: id, Algorithm: r.config.Hash, Name: name}); err != nil {
+			return RepoObj{}, errors.Context(err, "failed to write properties-file")
+		}
+		return r.openObject(id)
+	}
+	obj, err := r.openObject(id)
+	if err != nil {
+		return RepoObj{}, errors.Context(err, "content already present, but failed to open existing properties")
+	}
+	log.Infoln("Content already present as '" + obj.Name + "'. (object: " + id + ")")
+	if name == obj.Name || slices.Contains(obj.Aliases, name) || strings.ContainsAny(name, string(propTags0IllegalChars)) {
+		return obj, nil
+	}
+	obj.Aliases = append(obj.Aliases, name)
+	if err := r.writeProperties(&obj); err != nil {
+		return RepoObj{}, errors.Context(err, "failed to record alias in properties")
+	}
+	return obj, nil
 }
 
 func (r *Repo) Delete(id string) error {
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	path := r.repofilepath(id)
 	if err := os.Remove(path); err != nil {
 		return errors.Context(err, "Delete repository-object "+id)
@@ -478,71 +649,166 @@ func (r *Repo) Delete(id string) error {
 	return nil
 }
 
-// Save saves updated repo-object properties to the repository.
+// Save writes the properties of obj. The fields that were changed, compared to the saved properties, are
+// validated: the metadata and the custom fields, see `Schema`. Invalid values that were preserved upon reading,
+// see `Metadata.Validate`, do not prevent saving changes to other fields. Such a value is corrected, or
+// cleared, by setting its field.
 func (r *Repo) Save(obj RepoObj) error {
-	return r.writeProperties(obj.Id, obj.Name)
+	unlock, err := r.lock(LockShared)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var previous *RepoObj
+	if saved, err := r.openObject(obj.Id); err == nil {
+		previous = &saved
+	} else {
+		log.Debugln("Validating all fields, as saved properties are not available:", err.Error())
+		previous = &RepoObj{}
+	}
+	if err := obj.Meta.validateChanges(&previous.Meta); err != nil {
+		return err
+	}
+	if err := r.schema.validateChanges(&obj.Props, &previous.Props); err != nil {
+		return err
+	}
+	return r.writeProperties(&obj)
 }
 
 func (r *Repo) ObjectPath(objname string) string {
 	return r.repofilepath(objname)
 }
 
-func (r *Repo) OpenObject(objname string) (RepoObj, error) {
-	propspath := r.repofilepath(objname + repoPropertiesSuffix)
-	props, err := bufio_.OpenFileProcessStringLinesFunc(propspath, '\n', func(s string) ([2]string, error) {
-		// TODO fine-tuning trimming whitespace for comment-line matching
-		if len(s) == 0 || strings_.AnyPrefix(strings.TrimLeft(s, " \t"), "#", "!") {
-			return [2]string{}, bufio_.ErrProcessingIgnore
+// parseTags parses the value of a tags-property with the specified key, with tags separated by sep.
+func (o *RepoObj) parseTags(key, value string, sep byte) error {
+	// The key is the category, optionally followed by the path of the parent of nested tags.
+	// Categories and tags are recorded by key, see `sanitizeName`.
+	cat, parent, nested := strings.Cut(key, tagSeparator)
+	cat = sanitizeName(cat)
+	if cat == "" || strings.ContainsAny(cat, string(propTags0IllegalChars)) || isStandardDir(cat) {
+		return errors.Context(errors.ErrIllegal, "invalid category: "+cat)
+	}
+	if nested && !validTagPath(parent) {
+		return errors.Context(errors.ErrIllegal, "invalid parent tag: "+parent)
+	}
+	parent = sanitizeTagPath(parent)
+	for _, tag := range strings.Split(value, string(sep)) {
+		tag = sanitizeName(tag)
+		if tag == "" {
+			continue
+		}
+		if !validTagName(tag) {
+			return errors.Context(errors.ErrIllegal, "invalid tag: "+tag)
 		}
-		// TODO support ':' separator?
-		if key, value, ok := strings.Cut(s, "="); ok {
-			return [...]string{strings.TrimSpace(key), strings.TrimSpace(value)}, nil
+		if nested {
+			tag = parent + tagSeparator + tag
 		}
-		return [2]string{}, errors.ErrIllegal
-	})
+		o.addTag(cat, tag)
+	}
+	return nil
+}
+
+// OpenObject opens the object with the specified identifier. Invalid metadata and violations of the schema
+// are preserved as is, see `Metadata.Validate`, such that the object remains accessible and the values can be
+// corrected. Use `Metadata.Validate` and `Schema.Validate` to report them.
+func (r *Repo) OpenObject(objname string) (RepoObj, error) {
+	unlock, err := r.lock(LockShared)
+	if err != nil {
+		return RepoObj{}, err
+	}
+	defer unlock()
+	return r.openObject(objname)
+}
+
+// openObject opens the object with the specified identifier. Custom fields are not validated, such that
+// objects that violate the schema can be listed and corrected.
+func (r *Repo) openObject(objname string) (RepoObj, error) {
+	return r.loadObject(objname, version)
+}
+
+// loadObject reads the properties of objname, accepting any of the specified properties format versions.
+func (r *Repo) loadObject(objname string, versions ...string) (RepoObj, error) {
+	propspath := r.repofilepath(objname + repoPropertiesSuffix)
+	props, err := readPropertiesFile(propspath)
 	if err != nil {
 		return RepoObj{}, errors.Context(err, "failed to parse properties for "+objname)
 	}
 	var obj RepoObj
-	// TODO check allowed properties? (permit unknown properties?, as forward-compatibility?)
+	// anchor is the key of the last known property, which determines the position of unknown properties.
+	var anchor string
 	for _, p := range props {
-		if strings_.AnyPrefix(p[0], propTagsOldPrefix, propTags0Prefix) {
-			// Process arbitrary tag-categories later.
+		if strings.HasPrefix(p[0], propTags0Prefix) {
+			if err := obj.parseTags(strings.TrimPrefix(p[0], propTags0Prefix), p[1], propTagsSeparator); err != nil {
+				return RepoObj{}, errors.Context(err, "failed to parse tags property '"+p[0]+"'")
+			}
+			anchor = p[0]
+			continue
+		}
+		if strings.HasPrefix(p[0], propTagsOldPrefix) {
+			if err := obj.parseTags(strings.TrimPrefix(p[0], propTagsOldPrefix), p[1], propTagsOldSeparator); err != nil {
+				return RepoObj{}, errors.Context(err, "failed to parse tags property '"+p[0]+"'")
+			}
+			anchor = p[0]
 			continue
 		}
 		switch p[0] {
 		case propVersion:
-			if p[1] != version {
-				return RepoObj{}, errors.Context(errors.ErrFailure, "version of properties is not supported")
+			if !slices.Contains(versions, p[1]) {
+				return RepoObj{}, errors.Context(errors.ErrFailure, "version of properties is not supported: "+p[1])
 			}
 		case propHash:
-			if !strings.HasPrefix(p[1], propHashspecPrefix) {
+			algorithm, id, ok := strings.Cut(p[1], propHashspecSeparator)
+			if !ok {
 				return RepoObj{}, errors.Context(errors.ErrIllegal, "hashspec must contain prefix for hash function")
 			}
-			obj.Id = strings.TrimPrefix(p[1], propHashspecPrefix)
+			if !supportedHash(algorithm) {
+				return RepoObj{}, errors.Context(errors.ErrUnsupported, "hash algorithm: "+algorithm)
+			}
+			obj.Id, obj.Algorithm = id, algorithm
 		case propName:
 			obj.Name = p[1]
+		case propAliases:
+			for _, alias := range strings.Split(p[1], string(propTagsSeparator)) {
+				if alias = strings.TrimSpace(alias); alias != "" && !slices.Contains(obj.Aliases, alias) {
+					obj.Aliases = append(obj.Aliases, alias)
+				}
+			}
+		case propCiteKey:
+			obj.CiteKey = p[1]
+		case FieldNotes:
+			obj.Meta.Notes = unescapeMultiline(p[1])
+		case FieldAuthors, FieldTitle, FieldYear, FieldPublisher, FieldDOI, FieldISBN, FieldURL, FieldLanguage:
+			// Invalid metadata is preserved, such that the object remains accessible. See `Metadata.Validate`.
+			if err := obj.Meta.setLenient(p[0], p[1]); err != nil {
+				log.Debugln("Invalid metadata in properties of", objname+":", err.Error())
+			}
 		default:
-			// FIXME handle unknown property (should not panic, incomplete implementation)
-			panic("To be implemented")
+			// Unknown properties are preserved, in place, for forward-compatibility and user-defined properties.
+			obj.Props.add(p[0], p[1], anchor)
+			continue
 		}
+		anchor = p[0]
 	}
 	return obj, nil
 }
 
 // TODO could use caching in case the repository has not changed. (Is this really possible if we also expect to read some values from the file system structure?)
 func (r *Repo) List() ([]RepoObj, error) {
-	var err error
-	var direntries []os.DirEntry
-	if direntries, err = os.ReadDir(r.repofilepath("")); err != nil {
+	unlock, err := r.lock(LockShared)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	direntries, err := r.readRepoEntries()
+	if err != nil {
 		return nil, errors.Context(err, "failed to open repo-data for listing content")
 	}
 	var objects []RepoObj
 	for _, e := range direntries {
-		if strings.HasSuffix(e.Name(), repoPropertiesSuffix) {
+		if !r.isObjectEntry(e) {
 			continue
 		}
-		if obj, err := r.OpenObject(e.Name()); err == nil {
+		if obj, err := r.openObject(e.Name()); err == nil {
 			objects = append(objects, obj)
 		} else {
 			log.Infoln("Skipping", e.Name(), ": failed to open repo-object:", err.Error())
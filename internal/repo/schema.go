@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cobratbq/goutils/std/errors"
+	os_ "github.com/cobratbq/goutils/std/os"
+)
+
+// schemaFilename is the name of the (optional) schema-file in the repository root, which defines custom
+// fields for the properties of repository objects.
+//
+// Each line defines a field, as `<name>=<type>[;<option>…]`, with type one of `string`, `int`, `date`
+// (`YYYY-MM-DD`), `enum`, `bool` and `url`. Options are `required`, `default=<value>` and, for enum,
+// `values=<value>,<value>,…`. For example:
+//
+//	invoice-amount=int;required
+//	contract-end=date
+//	status=enum;values=open,closed;default=open
+const schemaFilename = ".doclib.schema"
+
+// Types of custom fields.
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeDate   = "date"
+	TypeEnum   = "enum"
+	TypeBool   = "bool"
+	TypeURL    = "url"
+	// dateLayout is the representation of values of type date.
+	dateLayout = "2006-01-02"
+)
+
+const (
+	schemaOptionSeparator = ";"
+	schemaOptionRequired  = "required"
+	schemaOptionDefault   = "default="
+	schemaOptionValues    = "values="
+	schemaValuesSeparator = ","
+)
+
+// SchemaField is a custom field, as defined in the schema of the repository.
+type SchemaField struct {
+	Name     string
+	Type     string
+	Required bool
+	// Default is the value of the field for objects that do not specify it.
+	Default string
+	// Values are the acceptable values of a field of type enum.
+	Values []string
+}
+
+// Validate checks value against the type of the field. An empty value is acceptable for fields that are not
+// required.
+func (f *SchemaField) Validate(value string) error {
+	if value == "" {
+		if f.Required {
+			return errors.Context(errors.ErrIllegal, f.Name+": value is required")
+		}
+		return nil
+	}
+	var err error
+	switch f.Type {
+	case TypeString:
+	case TypeInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case TypeDate:
+		_, err = time.Parse(dateLayout, value)
+	case TypeEnum:
+		if !slices.Contains(f.Values, value) {
+			err = errors.ErrIllegal
+		}
+	case TypeBool:
+		if value != "true" && value != "false" {
+			err = errors.ErrIllegal
+		}
+	case TypeURL:
+		err = validateURL(value)
+	default:
+		err = errors.ErrUnsupported
+	}
+	if err != nil {
+		return errors.Context(errors.ErrIllegal, f.Name+": expected "+f.describe()+": "+value)
+	}
+	return nil
+}
+
+// Value returns the value of the field in props, or the default value if the field is absent. Defaults are
+// not stored, such that a change of default applies to all objects that do not specify the field.
+func (f *SchemaField) Value(props *Properties) string {
+	if value, ok := props.Get(f.Name); ok {
+		return value
+	}
+	return f.Default
+}
+
+// describe describes the acceptable values of the field.
+func (f *SchemaField) describe() string {
+	switch f.Type {
+	case TypeDate:
+		return "date (YYYY-MM-DD)"
+	case TypeEnum:
+		return "one of " + strings.Join(f.Values, ", ")
+	case TypeBool:
+		return "true or false"
+	default:
+		return f.Type
+	}
+}
+
+// Schema defines the custom fields for the properties of repository objects. Custom fields are stored as
+// general properties, see `RepoObj.Props`.
+type Schema struct {
+	Fields []SchemaField
+}
+
+// Field returns the definition of the field with the specified name.
+func (s Schema) Field(name string) (SchemaField, bool) {
+	idx := slices.IndexFunc(s.Fields, func(f SchemaField) bool { return f.Name == name })
+	if idx < 0 {
+		return SchemaField{}, false
+	}
+	return s.Fields[idx], true
+}
+
+// Validate checks the properties, with default values for absent fields, against the fields of the schema.
+// All violations are reported.
+func (s Schema) Validate(props *Properties) error {
+	return s.validateChanges(props, nil)
+}
+
+// validateChanges checks the fields of which the value differs from previous, or all fields if previous is
+// nil. Violations that exist already, and are left unchanged, therefore do not prevent changes to other fields.
+func (s Schema) validateChanges(props, previous *Properties) error {
+	var violations []error
+	for _, f := range s.Fields {
+		if previous != nil && f.Value(props) == f.Value(previous) {
+			continue
+		}
+		if err := f.Validate(f.Value(props)); err != nil {
+			violations = append(violations, err)
+		}
+	}
+	if len(violations) > 0 {
+		return errors.Aggregate(violations[0], "properties violate schema", violations[1:]...)
+	}
+	return nil
+}
+
+// readSchema reads the schema of the repository at location. A repository without schema-file has an empty
+// schema.
+func readSchema(location string) (Schema, error) {
+	path := filepath.Join(location, schemaFilename)
+	if !os_.Exists(path) {
+		return Schema{}, nil
+	}
+	defs, err := readPropertiesFile(path)
+	if err != nil {
+		return Schema{}, errors.Context(err, "failed to read schema")
+	}
+	var schema Schema
+	for _, def := range defs {
+		f, err := parseSchemaField(def[0], def[1])
+		if err != nil {
+			return Schema{}, errors.Context(err, "invalid definition of field '"+def[0]+"' in schema")
+		}
+		if _, ok := schema.Field(f.Name); ok {
+			return Schema{}, errors.Context(errors.ErrIllegal, "duplicate definition of field '"+f.Name+"' in schema")
+		}
+		schema.Fields = append(schema.Fields, f)
+	}
+	return schema, nil
+}
+
+func parseSchemaField(name, spec string) (SchemaField, error) {
+	if err := validateProperty(name, ""); err != nil {
+		return SchemaField{}, err
+	}
+	options := strings.Split(spec, schemaOptionSeparator)
+	f := SchemaField{Name: name, Type: strings.TrimSpace(options[0])}
+	switch f.Type {
+	case TypeString, TypeInt, TypeDate, TypeEnum, TypeBool, TypeURL:
+	default:
+		return SchemaField{}, errors.Context(errors.ErrUnsupported, "type: "+f.Type)
+	}
+	for _, o := range options[1:] {
+		switch o = strings.TrimSpace(o); {
+		case o == schemaOptionRequired:
+			f.Required = true
+		case strings.HasPrefix(o, schemaOptionDefault):
+			f.Default = strings.TrimSpace(strings.TrimPrefix(o, schemaOptionDefault))
+		case strings.HasPrefix(o, schemaOptionValues):
+			for _, v := range strings.Split(strings.TrimPrefix(o, schemaOptionValues), schemaValuesSeparator) {
+				if v = strings.TrimSpace(v); v != "" {
+					f.Values = append(f.Values, v)
+				}
+			}
+		default:
+			return SchemaField{}, errors.Context(errors.ErrIllegal, "unknown option: "+o)
+		}
+	}
+	if f.Type == TypeEnum && len(f.Values) == 0 {
+		return SchemaField{}, errors.Context(errors.ErrIllegal, "enum requires option '"+schemaOptionValues+"'")
+	}
+	if f.Default != "" {
+		if err := f.Validate(f.Default); err != nil {
+			return SchemaField{}, errors.Context(err, "invalid default")
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cobratbq/goutils/std/errors"
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestParseSchemaField(t *testing.T) {
+	testdata := []struct {
+		name     string
+		spec     string
+		expected SchemaField
+		err      error
+	}{
+		{"remark", "string", SchemaField{Name: "remark", Type: TypeString}, nil},
+		{"amount", "int;required", SchemaField{Name: "amount", Type: TypeInt, Required: true}, nil},
+		{"amount", " int ; required ", SchemaField{Name: "amount", Type: TypeInt, Required: true}, nil},
+		{"end", "date;default=2030-01-01", SchemaField{Name: "end", Type: TypeDate, Default: "2030-01-01"}, nil},
+		{"status", "enum;values=open, closed;default=open",
+			SchemaField{Name: "status", Type: TypeEnum, Default: "open", Values: []string{"open", "closed"}}, nil},
+		{"paid", "bool;default=false", SchemaField{Name: "paid", Type: TypeBool, Default: "false"}, nil},
+		{"link", "url", SchemaField{Name: "link", Type: TypeURL}, nil},
+		{"amount", "float", SchemaField{}, errors.ErrUnsupported},
+		{"amount", "", SchemaField{}, errors.ErrUnsupported},
+		{"amount", "int;optional", SchemaField{}, errors.ErrIllegal},
+		{"amount", "int;default=many", SchemaField{}, errors.ErrIllegal},
+		{"status", "enum", SchemaField{}, errors.ErrIllegal},
+		{"status", "enum;values=open;default=closed", SchemaField{}, errors.ErrIllegal},
+		{"end", "date;default=2030-13-01", SchemaField{}, errors.ErrIllegal},
+		// fields are stored as general properties, therefore known properties cannot be defined
+		{FieldTitle, "string", SchemaField{}, errors.ErrIllegal},
+		{"#amount", "int", SchemaField{}, errors.ErrIllegal},
+	}
+	for _, d := range testdata {
+		f, err := parseSchemaField(d.name, d.spec)
+		if d.err == nil {
+			assert.Nil(t, err)
+			assert.Equal(t, d.expected.Name, f.Name)
+			assert.Equal(t, d.expected.Type, f.Type)
+			assert.Equal(t, d.expected.Required, f.Required)
+			assert.Equal(t, d.expected.Default, f.Default)
+			assert.SlicesEqual(t, d.expected.Values, f.Values)
+		} else {
+			assert.IsError(t, d.err, err)
+		}
+		assert.LogOnFailure(t, d.name+"="+d.spec)
+	}
+}
+
+func TestSchemaFieldValidate(t *testing.T) {
+	testdata := []struct {
+		spec  string
+		value string
+		valid bool
+	}{
+		{"string", "anything", true},
+		{"string", "", true},
+		{"string;required", "", false},
+		{"int", "42", true},
+		{"int", "-42", true},
+		{"int", "4.2", false},
+		{"int", "many", false},
+		{"date", "2024-02-29", true},
+		{"date", "2023-02-29", false},
+		{"date", "29-02-2024", false},
+		{"enum;values=open,closed", "open", true},
+		{"enum;values=open,closed", "Open", false},
+		{"enum;values=open,closed", "", true},
+		{"enum;values=open,closed;required", "", false},
+		{"bool", "true", true},
+		{"bool", "false", true},
+		{"bool", "yes", false},
+		{"url", "https://example.org/path", true},
+		{"url", "example.org", false},
+		{"url", "https://example.org/with space", false},
+	}
+	for _, d := range testdata {
+		f, err := parseSchemaField("field", d.spec)
+		assert.Nil(t, err)
+		err = f.Validate(d.value)
+		if d.valid {
+			assert.Nil(t, err)
+		} else {
+			assert.IsError(t, errors.ErrIllegal, err)
+		}
+		assert.LogOnFailure(t, d.spec, d.value)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Schema{Fields: []SchemaField{
+		{Name: "amount", Type: TypeInt, Required: true},
+		{Name: "status", Type: TypeEnum, Values: []string{"open", "closed"}, Default: "open"},
+	}}
+	testdata := []struct {
+		name     string
+		props    map[string]string
+		previous map[string]string
+		valid    bool
+	}{
+		{"valid", map[string]string{"amount": "1", "status": "closed"}, nil, true},
+		{"default applies", map[string]string{"amount": "1"}, nil, true},
+		{"required absent", map[string]string{"status": "closed"}, nil, false},
+		{"invalid value", map[string]string{"amount": "1", "status": "pending"}, nil, false},
+		{"unknown properties are ignored", map[string]string{"amount": "1", "other": "x"}, nil, true},
+		// only changed fields are validated
+		{"unchanged violation", map[string]string{"status": "closed"}, map[string]string{}, true},
+		{"changed violation", map[string]string{"amount": "many"}, map[string]string{}, false},
+		{"changed to default", map[string]string{"status": "open"}, map[string]string{}, true},
+	}
+	toProperties := func(values map[string]string) *Properties {
+		var props Properties
+		for k, v := range values {
+			assert.Nil(t, props.Set(k, v))
+		}
+		return &props
+	}
+	for _, d := range testdata {
+		var err error
+		if d.previous == nil {
+			err = schema.Validate(toProperties(d.props))
+		} else {
+			err = schema.validateChanges(toProperties(d.props), toProperties(d.previous))
+		}
+		if d.valid {
+			assert.Nil(t, err)
+		} else {
+			assert.IsError(t, errors.ErrIllegal, err)
+		}
+		assert.LogOnFailure(t, d.name)
+	}
+}
+
+func TestReadSchema(t *testing.T) {
+	testdata := []struct {
+		name   string
+		schema string
+		fields []string
+		valid  bool
+	}{
+		{"absent", "", nil, true},
+		{"fields in order", "b=int\na=string\n# comment\nc=bool\n", []string{"b", "a", "c"}, true},
+		{"duplicate field", "a=int\na=string\n", nil, false},
+		{"invalid field", "a=int;unknown\n", nil, false},
+	}
+	for _, d := range testdata {
+		location := t.TempDir()
+		if d.schema != "" {
+			assert.Nil(t, os.WriteFile(filepath.Join(location, schemaFilename), []byte(d.schema), 0o600))
+		}
+		schema, err := readSchema(location)
+		if d.valid {
+			assert.Nil(t, err)
+			var names []string
+			for _, f := range schema.Fields {
+				names = append(names, f.Name)
+			}
+			assert.SlicesEqual(t, d.fields, names)
+		} else {
+			assert.NotNil(t, err)
+		}
+		assert.LogOnFailure(t, d.name)
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cobratbq/goutils/std/errors"
+	"github.com/cobratbq/goutils/std/log"
+)
+
+// ScrubOptions configures the portion of the repository that is verified in a single scrub.
+type ScrubOptions struct {
+	// MaxBytes is the budget of content, in bytes, to verify. Zero means unlimited. At least one object is
+	// verified, even if its size exceeds the budget, such that scrubbing always progresses.
+	MaxBytes uint64
+	// MaxObjects is the maximum number of objects to verify. Zero means unlimited.
+	MaxObjects uint
+	// Workers is the number of workers that hash content in parallel. Zero defaults to the number of CPUs.
+	Workers uint
+}
+
+// ScrubReport is the result of a scrub.
+type ScrubReport struct {
+	// Findings lists corruption and failures.
+	Findings []Finding
+	// Hashed is the number of objects whose content was hashed.
+	Hashed uint
+	// Remaining is the number of objects that were not verified in this scrub, being left for later scrubs.
+	Remaining uint
+}
+
+func (s *ScrubReport) add(f Finding) {
+	s.Findings = append(s.Findings, f)
+	log.Warnln(f.String())
+}
+
+// Count counts the findings with at least the specified severity.
+func (s *ScrubReport) Count(severity Severity) int {
+	var count int
+	for i := range s.Findings {
+		if s.Findings[i].Severity >= severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Scrub verifies the content of a bounded portion of the repository, for detection of bit-rot. Objects are
+// verified in order of their last verification, oldest first, with objects that were never verified before
+// all others. The result is recorded per object in the verification cache, such that consecutive scrubs
+// re-verify the whole repository on a rolling schedule. Scrubbing does not make any changes to the
+// repository content. The report lists corruption and failures.
+func (r *Repo) Scrub(opts ScrubOptions) (ScrubReport, error) {
+	var report ScrubReport
+	verifications, err := r.scrubObjects(&opts, &report)
+	if err != nil {
+		return report, err
+	}
+	// Verification happens without holding the lock, recording the results requires the exclusive lock.
+	unlock, err := r.lock(LockExclusive)
+	if err != nil {
+		return report, errors.Context(err, "failed to record scrub results in verification cache")
+	}
+	defer unlock()
+	if err := r.updateVerificationCache(verifications); err != nil {
+		return report, errors.Context(err, "failed to record scrub results in verification cache")
+	}
+	return report, nil
+}
+
+// scrubObjects verifies the selected portion of objects and returns the verifications. The objects are
+// selected under shared lock, the content is hashed without holding the lock.
+func (r *Repo) scrubObjects(opts *ScrubOptions, report *ScrubReport) (map[string]verification, error) {
+	unlock, err := r.lock(LockShared)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := r.readRepoEntries()
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	cache := readVerificationCache(r.location)
+	updated := map[string]verification{}
+	var candidates []hashJob
+	for _, e := range entries {
+		if !r.isObjectEntry(e) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			report.add(Finding{Kind: KindFailure, Severity: SeverityError, Path: r.repofilepath(e.Name()), Id: e.Name(),
+				Message: "failed to query repo-object: " + err.Error()})
+			continue
+		}
+		if v, ok := cache[e.Name()]; ok {
+			updated[e.Name()] = v
+		}
+		candidates = append(candidates, hashJob{name: e.Name(), info: info})
+	}
+	// Objects without verification have zero-time, therefore are ordered first.
+	slices.SortStableFunc(candidates, func(a, b hashJob) int {
+		if c := updated[a.name].verified.Compare(updated[b.name].verified); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	var jobs []hashJob
+	var budget uint64
+	for _, c := range candidates {
+		if opts.MaxObjects > 0 && uint(len(jobs)) >= opts.MaxObjects {
+			break
+		}
+		if opts.MaxBytes > 0 && len(jobs) > 0 && budget+uint64(c.info.Size()) > opts.MaxBytes {
+			break
+		}
+		budget += uint64(c.info.Size())
+		c.algorithm = r.objectHash(c.name)
+		jobs = append(jobs, c)
+	}
+	unlock()
+	log.Infoln("Scrubbing " + strconv.Itoa(len(jobs)) + " of " + strconv.Itoa(len(candidates)) + " objects (" +
+		strconv.FormatUint(budget, 10) + " bytes)…")
+	checksums := r.hashObjects(jobs, opts.Workers)
+	recordVerifications(updated, jobs, checksums)
+	report.Hashed, report.Remaining = uint(len(jobs)), uint(len(candidates)-len(jobs))
+	for _, j := range jobs {
+		path := r.repofilepath(j.name)
+		if result := checksums[j.name]; errors.Is(result.err, os.ErrNotExist) {
+			log.Debugln("Skipping repo-object that was removed or moved during scrub:", j.name)
+		} else if result.err != nil {
+			report.add(Finding{Kind: KindFailure, Severity: SeverityError, Path: path, Id: j.name,
+				Message: "failed to hash repo-object: " + result.err.Error()})
+		} else if result.checksum != j.name {
+			report.add(Finding{Kind: KindCorruption, Severity: SeverityError, Path: path, Id: j.name,
+				Message: "checksum does not match, possible corruption (checksum: " + result.checksum + ")"})
+		}
+	}
+	return updated, nil
+}
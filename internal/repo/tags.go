@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// tagSeparator separates the components in the path of a nested tag, e.g. `programming/go`. The path of a tag
+// corresponds to the path of its tag-directory within the category-directory.
+const tagSeparator = "/"
+
+// validTagName checks whether name is acceptable as name of a single (non-nested) tag.
+func validTagName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, string(propTags0IllegalChars))
+}
+
+// validTagPath checks whether tag is acceptable as path of a (possibly nested) tag.
+func validTagPath(tag string) bool {
+	for _, name := range strings.Split(tag, tagSeparator) {
+		if !validTagName(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// parentTag returns the path of the parent of tag, or an empty string for a top-level tag.
+func parentTag(tag string) string {
+	if idx := strings.LastIndex(tag, tagSeparator); idx >= 0 {
+		return tag[:idx]
+	}
+	return ""
+}
+
+// tagName returns the name of the tag itself, i.e. the last component of its path.
+func tagName(tag string) string {
+	return tag[strings.LastIndex(tag, tagSeparator)+1:]
+}
+
+// tagAncestors returns the paths of the ancestors of tag, top-level tag first.
+func tagAncestors(tag string) []string {
+	var ancestors []string
+	for parent := parentTag(tag); parent != ""; parent = parentTag(parent) {
+		ancestors = append([]string{parent}, ancestors...)
+	}
+	return ancestors
+}
+
+// tagdepth returns the depth of the tag-directory below the repository root, i.e. the depth of the symlinks
+// within the tag-directory.
+func tagdepth(tag string) int {
+	return 2 + strings.Count(tag, tagSeparator)
+}
+
+// sanitizeName returns the key of a category or tag with the specified name. The key is stable under
+// differences in capitalization and formatting: the name is Unicode-normalized (NFKC) and case-folded,
+// surrounding whitespace is removed, and runs of whitespace and dash or connector punctuation, e.g. `-` and
+// `_`, are replaced by a single `-`. Consequently, `Machine learning`, `machine_learning` and
+// `MACHINE-LEARNING ` all have key `machine-learning`.
+func sanitizeName(name string) string {
+	name = norm.NFKC.String(cases.Fold().String(norm.NFKC.String(name)))
+	var b strings.Builder
+	var gap bool
+	for _, c := range strings.TrimSpace(name) {
+		if unicode.IsSpace(c) || unicode.In(c, unicode.Pd, unicode.Pc) {
+			gap = true
+			continue
+		}
+		if gap {
+			b.WriteByte('-')
+			gap = false
+		}
+		b.WriteRune(c)
+	}
+	if gap {
+		b.WriteByte('-')
+	}
+	return b.String()
+}
+
+// sanitizeTagPath returns the key of a (possibly nested) tag, i.e. the path of keys of its components.
+func sanitizeTagPath(tag string) string {
+	names := strings.Split(tag, tagSeparator)
+	for i := range names {
+		names[i] = sanitizeName(names[i])
+	}
+	return strings.Join(names, tagSeparator)
+}
+
+// collision is a directory that resolves to the same key as another directory.
+type collision struct {
+	// path is the path of the colliding directory, relative to the repository root.
+	path string
+	// other is the path of the directory that is indexed for the key.
+	other string
+}
+
+// findCollisions finds category- and tag-directories that resolve to the same key as another directory at the
+// same level. Directories are considered in file system order, consistent with `readTagEntries`.
+func findCollisions(location string) ([]collision, error) {
+	var collisions []collision
+	var walk func(dir string, root bool) error
+	walk = func(dir string, root bool) error {
+		entries, err := os.ReadDir(filepath.Join(location, dir))
+		if err != nil {
+			return err
+		}
+		seen := map[string]string{}
+		for _, e := range entries {
+			if !e.IsDir() || root && (isStandardDir(e.Name()) || strings.HasPrefix(e.Name(), ".")) {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			key := sanitizeName(e.Name())
+			if other, ok := seen[key]; ok {
+				collisions = append(collisions, collision{path: path, other: other})
+				continue
+			}
+			seen[key] = path
+			if err := walk(path, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return collisions, walk("", true)
+}
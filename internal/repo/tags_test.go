@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: GPL-3.0-only
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	assert "github.com/cobratbq/goutils/std/testing"
+)
+
+func TestSanitizeName(t *testing.T) {
+	testdata := []struct {
+		name     string
+		expected string
+	}{
+		{"machine-learning", "machine-learning"},
+		// names that differ in capitalization and formatting collide
+		{"Machine learning", "machine-learning"},
+		{"machine_learning", "machine-learning"},
+		{"MACHINE-LEARNING ", "machine-learning"},
+		{"  machine \t learning", "machine-learning"},
+		{"machine--__learning", "machine-learning"},
+		{"machine‐learning", "machine-learning"},
+		{"machine–learning", "machine-learning"},
+		{"machine‿learning", "machine-learning"},
+		// Unicode normalization and case-folding
+		{"Straße", "strasse"},
+		{"STRASSE", "strasse"},
+		{"café", "café"},
+		{"cafe\u0301", "café"},
+		{"ﬁle", "file"},
+		{"Ｆｕｌｌｗｉｄｔｈ", "fullwidth"},
+		// leading and trailing dashes are retained
+		{"-draft", "-draft"},
+		{"draft_", "draft-"},
+		// other punctuation is retained
+		{"c++", "c++"},
+		{"v1.0", "v1.0"},
+		{"", ""},
+	}
+	for _, d := range testdata {
+		assert.Equal(t, d.expected, sanitizeName(d.name))
+		assert.LogOnFailure(t, d.name)
+	}
+}
+
+func TestSanitizeTagPath(t *testing.T) {
+	testdata := []struct {
+		tag      string
+		expected string
+	}{
+		{"crypto", "crypto"},
+		{"Programming/Go", "programming/go"},
+		{"Machine learning/Deep_Learning", "machine-learning/deep-learning"},
+		{"a/b/c", "a/b/c"},
+	}
+	for _, d := range testdata {
+		assert.Equal(t, d.expected, sanitizeTagPath(d.tag))
+		assert.LogOnFailure(t, d.tag)
+	}
+}
+
+func TestValidTagPath(t *testing.T) {
+	testdata := []struct {
+		tag   string
+		valid bool
+	}{
+		{"crypto", true},
+		{"programming/go", true},
+		{"a/b/c", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"programming/..", false},
+		{"programming/", false},
+		{"/programming", false},
+		{"programming//go", false},
+	}
+	for _, d := range testdata {
+		assert.Equal(t, d.valid, validTagPath(d.tag))
+		assert.LogOnFailure(t, d.tag)
+	}
+}
+
+func TestTagAncestors(t *testing.T) {
+	testdata := []struct {
+		tag       string
+		ancestors []string
+		depth     int
+	}{
+		{"crypto", nil, 2},
+		{"programming/go", []string{"programming"}, 3},
+		{"a/b/c", []string{"a", "a/b"}, 4},
+	}
+	for _, d := range testdata {
+		assert.SlicesEqual(t, d.ancestors, tagAncestors(d.tag))
+		assert.Equal(t, d.depth, tagdepth(d.tag))
+		assert.LogOnFailure(t, d.tag)
+	}
+}
+
+func TestReadTagEntriesCollisions(t *testing.T) {
+	location := t.TempDir()
+	for _, dir := range []string{
+		subdirRepo, subdirTitles, ".hidden",
+		"Topic/Machine learning/Deep_Learning",
+		"Topic/machine_learning",
+		"Topic/Crypto",
+		"topic/other",
+		"Status/read",
+	} {
+		assert.Nil(t, os.MkdirAll(filepath.Join(location, dir), 0o700))
+	}
+	assert.StopOnFailure(t)
+	index, err := readTagEntries(location)
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	assert.Equal(t, 2, len(index))
+	// Of directories that resolve to the same key, only the first in file system order is indexed.
+	assert.Equal(t, "Topic", index["topic"].dir)
+	var keys []string
+	for _, tag := range index["topic"].tags {
+		keys = append(keys, tag.Key)
+	}
+	assert.SlicesEqual(t, []string{"crypto", "machine-learning", "machine-learning/deep-learning"}, keys)
+	assert.Equal(t, filepath.Join("Machine learning", "Deep_Learning"), index["topic"].paths["machine-learning/deep-learning"])
+	cat := index["topic"]
+	assert.Equal(t, filepath.Join("Machine learning", "Deep_Learning"), cat.tagdir("MACHINE-LEARNING/deep learning"))
+	assert.Equal(t, filepath.Join("Machine learning", "New"), cat.tagdir("machine-learning/New"))
+	collisions, err := findCollisions(location)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(collisions))
+	assert.Equal(t, filepath.Join("Topic", "machine_learning"), collisions[0].path)
+	assert.Equal(t, filepath.Join("Topic", "Machine learning"), collisions[0].other)
+	assert.Equal(t, "topic", collisions[1].path)
+	assert.Equal(t, "Topic", collisions[1].other)
+}
+
+func TestTagIndex(t *testing.T) {
+	r, err := InitRepository(filepath.Join(t.TempDir(), "repo"),
+		InitOptions{Starters: []string{"topic/crypto", "topic/programming/go", "status/read"}})
+	assert.Nil(t, err)
+	a, _, err := r.Acquire(strings.NewReader("a"), "a.pdf")
+	assert.Nil(t, err)
+	b, _, err := r.Acquire(strings.NewReader("b"), "b.pdf")
+	assert.Nil(t, err)
+	assert.StopOnFailure(t)
+	assert.Nil(t, r.Tag("topic", "crypto", &a))
+	assert.Nil(t, r.Tag("Topic", "Programming/Go", &a))
+	assert.Nil(t, r.Tag("topic", "crypto", &b))
+	assert.Nil(t, r.Tag("status", "read", &b))
+	assert.StopOnFailure(t)
+	both := []string{a.Id, b.Id}
+	slices.Sort(both)
+	verify := func(msg string) {
+		assert.SlicesEqual(t, both, r.TaggedObjects("topic", "crypto"))
+		assert.SlicesEqual(t, []string{a.Id}, r.TaggedObjects("TOPIC", "programming/go"))
+		assert.SlicesEqual(t, []string{b.Id}, r.TaggedObjects("status", "read"))
+		assert.Equal(t, 0, len(r.TaggedObjects("topic", "programming")))
+		tags := r.ObjectTags(&a)
+		assert.Equal(t, 1, len(tags))
+		assert.SlicesEqual(t, []string{"crypto", "programming/go"}, tags["topic"])
+		assert.True(t, r.Tagged("topic", "Programming/Go", &a))
+		assert.False(t, r.Tagged("status", "read", &a))
+		assert.LogOnFailure(t, msg)
+	}
+	verify("after tagging")
+	// The index is rebuilt from the tag-symlinks.
+	assert.Nil(t, r.Reload())
+	verify("after reload")
+	assert.Nil(t, r.Untag("topic", "crypto", &b))
+	assert.SlicesEqual(t, []string{a.Id}, r.TaggedObjects("topic", "crypto"))
+	assert.False(t, r.Tagged("topic", "crypto", &b))
+	assert.True(t, r.Tagged("status", "read", &b))
+}
@@ -3,10 +3,15 @@
 package repo
 
 import (
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 
-	"github.com/cobratbq/goutils/std/builtin"
+	"github.com/cobratbq/goutils/std/errors"
+	io_ "github.com/cobratbq/goutils/std/io"
+	"github.com/cobratbq/goutils/std/log"
+
 	slices_ "github.com/cobratbq/goutils/std/builtin/slices"
 )
 
@@ -24,8 +29,54 @@ func objNameCompare(a, b RepoObj) int {
 	return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
 }
 
-func ExtractRepoObjectsSorted(docrepo *Repo) []RepoObj {
-	objects := builtin.Expect(docrepo.List())
+func ExtractRepoObjectsSorted(docrepo *Repo) ([]RepoObj, error) {
+	objects, err := docrepo.List()
+	if err != nil {
+		return nil, err
+	}
 	slices.SortFunc(objects, objNameCompare)
-	return objects
+	return objects, nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory, synchronizes it to storage, then
+// renames it to path. Consequently, path contains either the previous or the new content in its entirety,
+// even if interrupted by a crash or a full disk.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tempf, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix)
+	if err != nil {
+		return errors.Context(err, "failed to create temporary file")
+	}
+	defer io_.CloseLogged(tempf, "Failed to gracefully close temporary file.")
+	if _, err := tempf.Write(data); err != nil {
+		os.Remove(tempf.Name())
+		return errors.Context(err, "failed to write temporary file")
+	}
+	if err := tempf.Chmod(perm); err != nil {
+		os.Remove(tempf.Name())
+		return errors.Context(err, "failed to set permissions on temporary file")
+	}
+	if err := tempf.Sync(); err != nil {
+		os.Remove(tempf.Name())
+		return errors.Context(err, "failed to synchronize temporary file to storage")
+	}
+	if err := os.Rename(tempf.Name(), path); err != nil {
+		os.Remove(tempf.Name())
+		return errors.Context(err, "failed to move temporary file into place")
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir synchronizes a directory to storage, such that changes to its entries, e.g. creating or renaming
+// files, are durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return errors.Context(err, "failed to open directory for synchronization")
+	}
+	defer io_.CloseLogged(dir, "Failed to gracefully close directory.")
+	if err := dir.Sync(); err != nil {
+		log.Traceln("Failed to synchronize directory:", path, err.Error())
+		return errors.Context(err, "failed to synchronize directory to storage")
+	}
+	return nil
 }